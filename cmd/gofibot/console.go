@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gofibot "github.com/huqa/gofibot/internal/app/gofibot"
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/database"
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/proc"
+)
+
+const defaultConsoleChannel string = "#gofibot"
+
+// runConsole runs the modules in the terminal until the console is quit
+// or interrupted. Without dbFile a temporary database is used.
+func runConsole(ctx context.Context, log logger.Logger, botConfig config.BotConfiguration, nick, channel, dbFile string) error {
+	if channel == "" {
+		channel = defaultConsoleChannel
+		if len(botConfig.Channels) > 0 {
+			channel = botConfig.Channels[0]
+		}
+	}
+	if dbFile == "" {
+		dir, err := ioutil.TempDir("", "gofibot")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		dbFile = filepath.Join(dir, "console.db")
+	}
+	db, err := database.Open(dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	console, err := gofibot.NewConsole(log, db, botConfig, nick, channel, os.Stdin, os.Stdout)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		proc.WaitForInterrupt()
+		cancel()
+	}()
+	return console.Run(ctx)
+}
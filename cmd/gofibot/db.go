@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/database"
+)
+
+const dbCommands = `
+database commands, the bot must not be running:
+  db backup [file]                  copy the database, by default to the backup directory
+  db export [--format json] [file]  export every bucket, to stdout without a file
+  db import [--replace] <file>      import an export, - reads stdin, --replace
+                                    empties the imported buckets first
+  db compact                        rewrite the database without free pages
+  db inspect [bucket...]            list the top level buckets or show a bucket,
+                                    nested buckets are given one name at a time
+
+backups of a running bot are configured with database.backupSpec
+`
+
+// usage prints the flags and the commands of gofibot
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: gofibot [flags] [db <command>]")
+	fmt.Fprintln(out)
+	flag.PrintDefaults()
+	fmt.Fprint(out, dbCommands)
+}
+
+// runDB runs the database command in args
+func runDB(cfg config.DatabaseConfiguration, args []string) error {
+	if len(args) == 0 {
+		usage()
+		return errors.New("no database command given")
+	}
+	fs := flag.NewFlagSet("db "+args[0], flag.ContinueOnError)
+	switch args[0] {
+	case "backup":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		return backupDB(cfg, fs.Arg(0))
+	case "export":
+		format := fs.String("format", "json", "export format, only json is supported")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *format != "json" {
+			return fmt.Errorf("unsupported export format %s", *format)
+		}
+		return exportDB(cfg, fs.Arg(0))
+	case "import":
+		replace := fs.Bool("replace", false, "empty the imported buckets first")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New("usage: db import [--replace] <file>")
+		}
+		return importDB(cfg, fs.Arg(0), *replace)
+	case "compact":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		before, after, err := database.Compact(cfg.Path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("compacted %s from %d to %d bytes\n", cfg.Path, before, after)
+		return nil
+	case "inspect":
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		db, err := database.OpenReadOnly(cfg.Path)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return database.Inspect(db, fs.Args(), os.Stdout)
+	default:
+		usage()
+		return fmt.Errorf("unknown database command %s", args[0])
+	}
+}
+
+// backupDB copies the database to file or to the backup directory
+func backupDB(cfg config.DatabaseConfiguration, file string) error {
+	db, err := database.OpenReadOnly(cfg.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if file == "" {
+		file, err = database.ManualBackupTo(db, cfg.BackupDir)
+	} else {
+		err = database.Backup(db, file)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("backed up database to", file)
+	return nil
+}
+
+// exportDB exports the database to file or stdout
+func exportDB(cfg config.DatabaseConfiguration, file string) error {
+	db, err := database.OpenReadOnly(cfg.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if file == "" {
+		return database.Export(db, os.Stdout)
+	}
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := database.Export(db, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// importDB imports file, - reads stdin
+func importDB(cfg config.DatabaseConfiguration, file string, replace bool) error {
+	var in io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	db, err := database.Open(cfg.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return database.Import(db, in, replace)
+}
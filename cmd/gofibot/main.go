@@ -6,13 +6,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"time"
-
-	bolt "go.etcd.io/bbolt"
 
 	gofibot "github.com/huqa/gofibot/internal/app/gofibot"
 	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/database"
 	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/migrate"
 	"github.com/huqa/gofibot/internal/pkg/proc"
 )
 
@@ -34,26 +33,85 @@ func main() {
 		"bot-config",
 		"./config/bot-config.json",
 		"bot config file path")
+	console := flag.Bool(
+		"console",
+		false,
+		"run the modules in a terminal instead of connecting to irc")
+	consoleNick := flag.String(
+		"console-nick",
+		"user",
+		"nick of the console user")
+	consoleChannel := flag.String(
+		"console-channel",
+		"",
+		"channel of the console user, defaults to the first configured channel")
+	consoleDB := flag.String(
+		"console-db",
+		"",
+		"database file of the console, defaults to a temporary database")
+	databasePath := flag.String(
+		"db",
+		"",
+		"database file path, overrides the bot config")
+	migrateDryRun := flag.Bool(
+		"migrate-dry-run",
+		false,
+		"run the pending database migrations, roll them back and exit")
+	flag.Usage = usage
 	flag.Parse()
 
-	botConfig, err := config.LoadBotConfiguration(*botConfigFilePath)
+	overrides := config.Overrides{DatabasePath: *databasePath}
+	botConfig, err := config.LoadBotConfiguration(*botConfigFilePath, overrides)
 	if err != nil {
 		logger.Fatal("can't load bot configuration: ", err)
 		os.Exit(1)
 	}
-
 	appConfig.BotConfig = botConfig
 
 	log := logger.New(appConfig.Logger)
 
-	db, err := bolt.Open(fmt.Sprintf("./db/%s", botConfig.DatabaseFile), 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if flag.Arg(0) == "db" {
+		if err := runDB(botConfig.Database, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *console {
+		err := runConsole(ctx, log, botConfig, *consoleNick, *consoleChannel, *consoleDB)
+		if err != nil {
+			log.Fatal("console failed ", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	db, err := database.Open(botConfig.Database.Path)
 	if err != nil {
 		log.Fatal("failed to open database ", err)
 		os.Exit(1)
 	}
 	defer db.Close()
 
-	app, err := gofibot.NewApplication(ctx, log, db, appConfig.BotConfig)
+	if *migrateDryRun {
+		steps, err := gofibot.MigrateModules(log, db, migrate.Options{DryRun: true})
+		if err != nil {
+			log.Fatal("migration failed ", err)
+			os.Exit(1)
+		}
+		if len(steps) == 0 {
+			fmt.Println("no pending migrations")
+			return
+		}
+		fmt.Println("pending migrations:")
+		for _, step := range steps {
+			fmt.Println(" ", step)
+		}
+		return
+	}
+
+	app, err := gofibot.NewApplication(ctx, log, db, appConfig.BotConfig, *botConfigFilePath, overrides)
 	if err != nil {
 		log.Fatal("failed to create gofibot ", err)
 		os.Exit(1)
@@ -61,17 +119,29 @@ func main() {
 	defer app.Shutdown()
 	log.Info("started gofibot")
 
+	errs := make(chan error, 1)
 	go func() {
-		for {
-			if err := app.IRCService.Connect(); err != nil {
-				log.Error("connection error", err)
-				log.Info("reconnecting in 15 seconds")
-				time.Sleep(15 * time.Second)
-			}
-		}
+		errs <- app.Run()
 	}()
 
-	proc.WaitForInterrupt()
+	interrupt := proc.NotifyInterrupt()
+	hangup := proc.NotifyHangup()
+wait:
+	for {
+		select {
+		case <-interrupt:
+			break wait
+		case <-hangup:
+			if err := app.Reload(); err != nil {
+				log.Error("can't reload configuration: ", err)
+			}
+		case err := <-errs:
+			if err != nil {
+				log.Error("irc connection failed: ", err)
+			}
+			break wait
+		}
+	}
 
 	defer log.Info("stopping gofibot")
 }
@@ -0,0 +1,122 @@
+package gofibot
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const aliasBucket string = "Aliases"
+
+// aliases maps user-defined commands to existing commands. An alias may
+// carry arguments that are put before the arguments given by the user,
+// e.g. "tre" -> "w tampere". Expansions are stored in bbolt as json
+// arrays of the command and its arguments so quoted arguments survive.
+type aliases struct {
+	db *bolt.DB
+
+	mu      sync.RWMutex
+	aliases map[string][]string
+}
+
+// aliasEntry is an alias and the command and arguments it expands to
+type aliasEntry struct {
+	Alias     string
+	Expansion []string
+}
+
+func newAliases(db *bolt.DB) (*aliases, error) {
+	a := &aliases{
+		db:      db,
+		aliases: make(map[string][]string),
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(aliasBucket))
+		if err != nil {
+			return fmt.Errorf("could not create aliases bucket: %v", err)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var expansion []string
+			if err := json.Unmarshal(v, &expansion); err != nil {
+				// older aliases are stored as words separated by spaces
+				expansion = strings.Fields(string(v))
+			}
+			if len(expansion) == 0 {
+				return fmt.Errorf("invalid alias %s", k)
+			}
+			a.aliases[string(k)] = expansion
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Resolve returns the command and arguments alias expands to
+func (a *aliases) Resolve(alias string) (string, []string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	expansion, ok := a.aliases[alias]
+	if !ok {
+		return "", nil, false
+	}
+	return expansion[0], append([]string{}, expansion[1:]...), true
+}
+
+// Add stores alias for expansion, a command optionally followed by arguments
+func (a *aliases) Add(alias string, expansion []string) error {
+	if len(expansion) == 0 {
+		return fmt.Errorf("alias %s has no command", alias)
+	}
+	data, err := json.Marshal(expansion)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(aliasBucket)).Put([]byte(alias), data)
+	})
+	if err != nil {
+		return err
+	}
+	a.aliases[alias] = append([]string{}, expansion...)
+	return nil
+}
+
+// Delete removes alias, it returns false if there was no such alias
+func (a *aliases) Delete(alias string) (bool, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.aliases[alias]; !ok {
+		return false, nil
+	}
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(aliasBucket)).Delete([]byte(alias))
+	})
+	if err != nil {
+		return false, err
+	}
+	delete(a.aliases, alias)
+	return true, nil
+}
+
+// Entries returns aliases and their expansions sorted by alias
+func (a *aliases) Entries() []aliasEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	entries := make([]aliasEntry, 0, len(a.aliases))
+	for alias, expansion := range a.aliases {
+		entries = append(entries, aliasEntry{Alias: alias, Expansion: expansion})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Alias < entries[j].Alias
+	})
+	return entries
+}
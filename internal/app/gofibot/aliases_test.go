@@ -0,0 +1,70 @@
+package gofibot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestAliases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofibot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	// an alias stored before expansions were json
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(aliasBucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("tre"), []byte("w tampere"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := newAliases(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Add("ny", []string{"w", "new york"}); err != nil {
+		t.Fatal(err)
+	}
+	// aliases are loaded again from the database
+	a, err = newAliases(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		alias   string
+		command string
+		args    []string
+	}{
+		{"tre", "w", []string{"tampere"}},
+		{"ny", "w", []string{"new york"}},
+	}
+	for _, tt := range tests {
+		command, args, ok := a.Resolve(tt.alias)
+		if !ok || command != tt.command || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("Resolve(%s) = %s, %q, %v, want %s, %q", tt.alias, command, args, ok, tt.command, tt.args)
+		}
+	}
+
+	// arguments given with the alias don't change the alias
+	_, args, _ := a.Resolve("ny")
+	args = append(args, "extra")
+	if _, args, _ := a.Resolve("ny"); !reflect.DeepEqual(args, []string{"new york"}) {
+		t.Errorf("expansion of ny changed to %q", args)
+	}
+}
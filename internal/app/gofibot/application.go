@@ -2,6 +2,8 @@ package gofibot
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/huqa/gofibot/internal/pkg/config"
 	bolt "go.etcd.io/bbolt"
@@ -9,34 +11,84 @@ import (
 	"github.com/huqa/gofibot/internal/pkg/logger"
 )
 
+const shutdownTimeout time.Duration = 5 * time.Second
+
 // Application defines all necessary services to be used by gofibot
 type Application struct {
 	log        logger.Logger
 	IRCService IRCServiceInterface
+
+	ctx        context.Context
+	cancel     context.CancelFunc
+	mu         sync.Mutex
+	done       chan struct{}
+	configPath string
+	overrides  config.Overrides
+	reloadMu   sync.Mutex
 }
 
-// NewApplication construct a new gofibot application
+// NewApplication construct a new gofibot application, the configuration
+// is reloaded from configPath with overrides when it changes
 func NewApplication(
 	ctx context.Context,
 	log logger.Logger,
 	db *bolt.DB,
 	botConfig config.BotConfiguration,
+	configPath string,
+	overrides config.Overrides,
 ) (app *Application, err error) {
-	ircService := NewIRCService(log, db, botConfig)
+	ircService, err := NewIRCService(log, db, botConfig)
+	if err != nil {
+		log.Error("error creating irc service")
+		return app, err
+	}
 	err = ircService.Init()
 	if err != nil {
 		log.Error("error initializing irc service")
 		return app, err
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
 	app = &Application{
 		log:        log.Named("gofibot").WithContext(ctx),
 		IRCService: ircService,
+		ctx:        ctx,
+		cancel:     cancel,
+		configPath: configPath,
+		overrides:  overrides,
 	}
+	ircService.OnReload(app.Reload)
 
 	return app, nil
 }
 
+// Run connects to irc and blocks until Shutdown is called or
+// reconnecting is given up
+func (a *Application) Run() error {
+	a.mu.Lock()
+	a.done = make(chan struct{})
+	done := a.done
+	a.mu.Unlock()
+	defer close(done)
+
+	go a.watchConfig()
+	return a.IRCService.Run(a.ctx)
+}
+
+// Shutdown stops reconnecting, quits irc and stops all modules
 func (a *Application) Shutdown() {
+	a.cancel()
 	a.IRCService.Stop()
+
+	a.mu.Lock()
+	done := a.done
+	a.mu.Unlock()
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		a.log.Error("timed out waiting for irc connection to close")
+	}
 }
@@ -0,0 +1,54 @@
+package gofibot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// reloadRecorder records the configurations it is reloaded with
+type reloadRecorder struct {
+	IRCServiceInterface
+	reloaded []config.BotConfiguration
+}
+
+func (r *reloadRecorder) Reload(cfg config.BotConfiguration) error {
+	r.reloaded = append(r.reloaded, cfg)
+	return nil
+}
+
+func TestReloadOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofibot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bot-config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"databaseFile": "bot.db"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	irc := &reloadRecorder{}
+	dbPath := filepath.Join(dir, "data", "test.db")
+	app := &Application{
+		log:        &logger.LogWrapper{SugaredLogger: zap.NewNop().Sugar()},
+		IRCService: irc,
+		configPath: path,
+		overrides:  config.Overrides{DatabasePath: dbPath},
+	}
+	if err := app.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(irc.reloaded) != 1 {
+		t.Fatalf("reloaded %d times, want 1", len(irc.reloaded))
+	}
+	db := irc.reloaded[0].Database
+	if db.Path != dbPath || db.BackupDir != filepath.Join(dir, "data", "backups") {
+		t.Errorf("reloaded database %s backed up to %s, want the overridden path %s", db.Path, db.BackupDir, dbPath)
+	}
+}
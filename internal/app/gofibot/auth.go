@@ -0,0 +1,172 @@
+package gofibot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/lrstanley/girc"
+)
+
+// NickServ replies that tell whether IDENTIFY succeeded
+var (
+	nickServSuccess = []string{
+		"you are now identified",
+		"you are now logged in",
+		"password accepted",
+	}
+	nickServFailure = []string{
+		"invalid password",
+		"password incorrect",
+		"incorrect password",
+		"is not a registered nickname",
+		"isn't registered",
+	}
+)
+
+// newSASLMech returns the SASL mechanism configured for the bot or nil
+// if SASL is not in use
+func newSASLMech(cfg config.BotConfiguration) (girc.SASLMech, error) {
+	mech := strings.ToUpper(cfg.SASL.Mechanism)
+	switch mech {
+	case "", config.SASLPlain:
+		if cfg.SASL.User == "" && cfg.SASL.Password == "" {
+			return nil, nil
+		}
+		if cfg.SASL.User == "" || cfg.SASL.Password == "" {
+			return nil, fmt.Errorf("SASL PLAIN requires both user and password")
+		}
+		return &girc.SASLPlain{User: cfg.SASL.User, Pass: cfg.SASL.Password}, nil
+	case config.SASLExternal:
+		if !cfg.TLS || cfg.TLSCert == "" {
+			return nil, fmt.Errorf("SASL EXTERNAL requires tls and a client certificate")
+		}
+		return &girc.SASLExternal{Identity: cfg.SASL.User}, nil
+	default:
+		return nil, fmt.Errorf("unsupported SASL mechanism: %s", cfg.SASL.Mechanism)
+	}
+}
+
+// authenticator tracks services authentication for the current connection
+type authenticator struct {
+	log      logger.Logger
+	nickServ config.NickServConfiguration
+	sasl     bool
+
+	mu       sync.Mutex
+	done     chan struct{}
+	loggedIn bool
+}
+
+func newAuthenticator(log logger.Logger, cfg config.BotConfiguration, sasl bool) *authenticator {
+	return &authenticator{
+		log:      log.Named("auth"),
+		nickServ: cfg.NickServ,
+		sasl:     sasl,
+		done:     make(chan struct{}),
+	}
+}
+
+// register adds the girc handlers used to track authentication
+func (a *authenticator) register(client *girc.Client) {
+	client.Handlers.Add(girc.INITIALIZED, func(c *girc.Client, e girc.Event) {
+		a.reset()
+	})
+	client.Handlers.Add(girc.RPL_LOGGEDIN, func(c *girc.Client, e girc.Event) {
+		a.log.Info("authenticated: ", e.Last())
+		a.finish(true)
+	})
+	client.Handlers.Add(girc.ERR_SASLFAIL, func(c *girc.Client, e girc.Event) {
+		a.log.Error("SASL authentication failed: ", e.Last())
+	})
+	client.Handlers.Add(girc.NOTICE, func(c *girc.Client, e girc.Event) {
+		if e.Source == nil || !strings.EqualFold(e.Source.Name, a.nickServ.Service) {
+			return
+		}
+		message := strings.ToLower(e.Last())
+		for _, s := range nickServSuccess {
+			if strings.Contains(message, s) {
+				a.log.Info("identified to ", a.nickServ.Service)
+				a.finish(true)
+				return
+			}
+		}
+		for _, s := range nickServFailure {
+			if strings.Contains(message, s) {
+				a.log.Error("identifying to ", a.nickServ.Service, " failed: ", e.Last())
+				a.finish(false)
+				return
+			}
+		}
+	})
+}
+
+// reset clears the authentication state for a new connection
+func (a *authenticator) reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.done = make(chan struct{})
+	a.loggedIn = false
+}
+
+// finish marks the authentication attempt of this connection as done
+func (a *authenticator) finish(loggedIn bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	select {
+	case <-a.done:
+		// already finished, a late success still counts
+		a.loggedIn = a.loggedIn || loggedIn
+		return
+	default:
+	}
+	a.loggedIn = loggedIn
+	close(a.done)
+}
+
+func (a *authenticator) state() (chan struct{}, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.done, a.loggedIn
+}
+
+// authenticate blocks until the bot is authenticated or authentication
+// has failed or timed out. SASL is handled during registration, so this
+// falls back to NickServ IDENTIFY only when SASL did not log us in.
+func (a *authenticator) authenticate(client *girc.Client) bool {
+	done, loggedIn := a.state()
+	select {
+	case <-done:
+		return loggedIn
+	default:
+	}
+	if a.nickServ.Password == "" {
+		if a.sasl {
+			a.log.Error("SASL is configured but the server did not log us in")
+		}
+		return false
+	}
+
+	identify := "IDENTIFY " + a.nickServ.Password
+	if a.nickServ.Account != "" {
+		identify = "IDENTIFY " + a.nickServ.Account + " " + a.nickServ.Password
+	}
+	a.log.Info("identifying to ", a.nickServ.Service)
+	client.Send(&girc.Event{
+		Command:   girc.PRIVMSG,
+		Params:    []string{a.nickServ.Service, identify},
+		Sensitive: true,
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Duration(a.nickServ.Timeout) * time.Second):
+		a.log.Error("no reply from ", a.nickServ.Service, ", joining channels unauthenticated")
+		a.finish(false)
+	}
+	_, loggedIn = a.state()
+	return loggedIn
+}
@@ -0,0 +1,35 @@
+package gofibot
+
+import (
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/database"
+)
+
+const backupJob string = coreModuleName + "/backup"
+
+// scheduleBackup schedules the hot backup of the database, a
+// configuration without a schedule removes it
+func (m *ModuleService) scheduleBackup(cfg config.DatabaseConfiguration) error {
+	if cfg.BackupSpec == "" {
+		m.scheduler.Remove(backupJob)
+		return nil
+	}
+	return m.scheduler.Add(backupJob, cfg.BackupSpec, false, func(time.Time) {
+		m.backup()
+	})
+}
+
+// backup writes a backup of the database and removes old backups
+func (m *ModuleService) backup() {
+	m.mu.RLock()
+	cfg := m.database
+	m.mu.RUnlock()
+	path, err := database.BackupTo(m.db, cfg.BackupDir, cfg.BackupKeep)
+	if err != nil {
+		m.log.Error("can't back up database: ", err)
+		return
+	}
+	m.log.Info("backed up database to ", path)
+}
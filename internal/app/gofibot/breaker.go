@@ -0,0 +1,95 @@
+package gofibot
+
+import (
+	"sync"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+)
+
+// breaker is a circuit breaker for modules. A module that fails too often
+// within a time window is disabled until the cooldown has passed.
+type breaker struct {
+	mu       sync.Mutex
+	failures int
+	window   time.Duration
+	cooldown time.Duration
+	modules  map[string]*moduleHealth
+}
+
+// moduleHealth holds the recent failures of a module
+type moduleHealth struct {
+	failures  []time.Time
+	openUntil time.Time
+}
+
+func newBreaker(cfg config.ExecutionConfiguration) *breaker {
+	return &breaker{
+		failures: cfg.BreakerFailures,
+		window:   time.Duration(cfg.BreakerWindow) * time.Second,
+		cooldown: time.Duration(cfg.BreakerCooldown) * time.Second,
+		modules:  make(map[string]*moduleHealth),
+	}
+}
+
+// SetConfig replaces the limits, failures counted so far are kept
+func (b *breaker) SetConfig(cfg config.ExecutionConfiguration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = cfg.BreakerFailures
+	b.window = time.Duration(cfg.BreakerWindow) * time.Second
+	b.cooldown = time.Duration(cfg.BreakerCooldown) * time.Second
+}
+
+// Cooldown returns how long failing modules are disabled
+func (b *breaker) Cooldown() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cooldown
+}
+
+// Open returns true if module is disabled at now
+func (b *breaker) Open(module string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h, ok := b.modules[module]
+	return ok && now.Before(h.openUntil)
+}
+
+// Failure records a failure of module at now and returns true if the
+// failure disabled the module
+func (b *breaker) Failure(module string, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures <= 0 {
+		return false
+	}
+	h, ok := b.modules[module]
+	if !ok {
+		h = &moduleHealth{}
+		b.modules[module] = h
+	}
+	if now.Before(h.openUntil) {
+		return false
+	}
+	recent := h.failures[:0]
+	for _, t := range h.failures {
+		if now.Sub(t) < b.window {
+			recent = append(recent, t)
+		}
+	}
+	h.failures = append(recent, now)
+	if len(h.failures) < b.failures {
+		return false
+	}
+	h.failures = h.failures[:0]
+	h.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+// Reset enables module again and forgets its failures
+func (b *breaker) Reset(module string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.modules, module)
+}
@@ -0,0 +1,252 @@
+package gofibot
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/migrate"
+	"github.com/huqa/gofibot/internal/pkg/modules"
+	"github.com/huqa/gofibot/internal/pkg/scheduler"
+	"github.com/lrstanley/girc"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// consoleHost is the host of console users, they are owners of the bot
+	consoleHost     string = "console"
+	consoleTimeForm string = "2006-01-02 15:04"
+)
+
+const consoleHelp = `lines are sent to the current channel as the current nick, commands:
+  /nick <nick>          change your nick
+  /join <#channel>      talk on channel
+  /query                talk to the bot privately
+  /me <action>          send an action
+  /time                 show the time of the fake clock
+  /advance <duration>   move the clock forward, e.g. /advance 90m
+  /set <date time>      set the clock, e.g. /set 2026-10-19 00:00
+  /help                 show this help
+  /quit                 quit the console`
+
+// Console runs the modules of the bot against a terminal instead of an
+// irc network. Scheduled jobs run on a fake clock moved by console
+// commands.
+type Console struct {
+	moduleService ModuleServiceInterface
+	clock         *scheduler.FakeClock
+	location      *time.Location
+	botNick       string
+	in            io.Reader
+	out           *consoleSender
+
+	nick    string
+	channel string
+	private bool
+}
+
+// NewConsole constructs a Console that talks as nick on channel
+func NewConsole(log logger.Logger, db *bolt.DB, cfg config.BotConfiguration, nick, channel string, in io.Reader, out io.Writer) (*Console, error) {
+	loc := loadLocation(log, cfg.Location)
+	cfg.Owners = append(append([]string{}, cfg.Owners...), "*!*@"+consoleHost)
+	// the console database is not the one backups are configured for
+	cfg.Database.BackupSpec = ""
+	// jobs running on every channel run on the console channel too
+	if !containsChannel(cfg.Channels, channel) {
+		cfg.Channels = append(append([]string{}, cfg.Channels...), channel)
+	}
+
+	sender := &consoleSender{out: out, nick: cfg.Nick}
+	responder := modules.NewResponder(sender)
+	moduleService, err := NewModuleService(log, cfg, loc, db, responder, responder)
+	if err != nil {
+		return nil, err
+	}
+	clock := scheduler.NewFakeClock(time.Now().In(loc))
+	moduleService.SetClock(clock)
+	botmodules := botModules(log, responder, db, loc)
+	_, err = migrateModules(log, db, botmodules, migrate.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("can't migrate module data: %v", err)
+	}
+	err = moduleService.RegisterModules(botmodules...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Console{
+		moduleService: moduleService,
+		clock:         clock,
+		location:      loc,
+		botNick:       cfg.Nick,
+		in:            in,
+		out:           sender,
+		nick:          nick,
+		channel:       channel,
+	}, nil
+}
+
+// Run reads lines until the input ends, /quit is typed or ctx is done
+func (c *Console) Run(ctx context.Context) error {
+	defer c.moduleService.StopModules()
+
+	lines := make(chan string)
+	errs := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(c.in)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		errs <- scanner.Err()
+	}()
+
+	c.out.print(consoleHelp)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			return err
+		case line := <-lines:
+			if !c.handle(line) {
+				return nil
+			}
+		}
+	}
+}
+
+// handle runs a console command or sends line to the bot, it returns
+// false when the console should quit
+func (c *Console) handle(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return true
+	}
+	if !strings.HasPrefix(line, "/") {
+		c.send(line)
+		return true
+	}
+
+	command, arg := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		command, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	switch command {
+	case "/quit":
+		return false
+	case "/help":
+		c.out.print(consoleHelp)
+	case "/nick":
+		if arg == "" {
+			c.out.print("usage: /nick <nick>")
+			return true
+		}
+		c.nick = arg
+		c.out.printf("you are now %s", c.nick)
+	case "/join":
+		if !girc.IsValidChannel(arg) {
+			c.out.print("usage: /join <#channel>")
+			return true
+		}
+		c.channel, c.private = arg, false
+		c.out.printf("talking on %s", c.channel)
+	case "/query":
+		c.private = true
+		c.out.printf("talking to %s", c.botNick)
+	case "/me":
+		c.send(fmt.Sprintf("\x01ACTION %s\x01", arg))
+	case "/time":
+		c.out.printf("the time is %s", c.clock.Now().In(c.location).Format(consoleTimeForm))
+	case "/advance":
+		d, err := time.ParseDuration(arg)
+		if err != nil || d <= 0 {
+			c.out.print("usage: /advance <duration>, e.g. /advance 90m")
+			return true
+		}
+		c.clock.Advance(d)
+		c.out.printf("the time is %s", c.clock.Now().In(c.location).Format(consoleTimeForm))
+	case "/set":
+		t, err := time.ParseInLocation(consoleTimeForm, arg, c.location)
+		if err != nil {
+			c.out.print("usage: /set <date time>, e.g. /set 2026-10-19 00:00")
+			return true
+		}
+		c.clock.Set(t)
+		c.out.printf("the time is %s", t.Format(consoleTimeForm))
+	default:
+		c.out.printf("unknown command %s, see /help", command)
+	}
+	return true
+}
+
+// send sends message to the bot as a PRIVMSG from the console user
+func (c *Console) send(message string) {
+	target := c.channel
+	if c.private {
+		target = c.botNick
+	}
+	c.moduleService.Dispatch(&girc.Event{
+		Source:  &girc.Source{Name: c.nick, Ident: c.nick, Host: consoleHost},
+		Command: girc.PRIVMSG,
+		Params:  []string{target, message},
+	})
+}
+
+// consoleSender implements modules.Sender by printing to the terminal
+type consoleSender struct {
+	mu   sync.Mutex
+	out  io.Writer
+	nick string
+}
+
+func (s *consoleSender) print(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(s.out, line)
+}
+
+func (s *consoleSender) printf(format string, args ...interface{}) {
+	s.print(fmt.Sprintf(format, args...))
+}
+
+// printLines prints every non-empty line of message like the irc
+// adapter sends them
+func (s *consoleSender) printLines(format, target, message string) {
+	for _, line := range strings.Split(message, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		s.printf(format, target, s.nick, line)
+	}
+}
+
+// Message prints a PRIVMSG to target
+func (s *consoleSender) Message(target, message string) {
+	s.printLines("[%s] <%s> %s", target, message)
+}
+
+// Notice prints a NOTICE to target
+func (s *consoleSender) Notice(target, message string) {
+	s.printLines("[%s] -%s- %s", target, message)
+}
+
+// Action prints a CTCP ACTION (/me) to target
+func (s *consoleSender) Action(target, message string) {
+	s.printLines("[%s] * %s %s", target, message)
+}
+
+// Topic prints a topic change of channel
+func (s *consoleSender) Topic(channel, topic string) {
+	s.printf("[%s] %s changes topic to: %s", channel, s.nick, topic)
+}
+
+// Kick prints a kick of nick from channel
+func (s *consoleSender) Kick(channel, nick, reason string) {
+	s.printf("[%s] %s kicks %s (%s)", channel, s.nick, nick, reason)
+}
@@ -0,0 +1,70 @@
+package gofibot
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// runConsole sends input to a console talking as nick on testChannel and
+// returns what the console printed
+func runConsole(t *testing.T, input string) string {
+	t.Helper()
+	db, closeDB := openTestDB(t)
+	defer closeDB()
+
+	log := &logger.LogWrapper{SugaredLogger: zap.NewNop().Sugar()}
+	cfg := config.BotConfiguration{
+		Nick:     testNick,
+		Channels: []string{testChannel},
+		Prefix:   "!",
+		Location: "UTC",
+		Execution: config.ExecutionConfiguration{
+			Timeout:   5,
+			Workers:   1,
+			QueueSize: 10,
+		},
+	}
+	var out bytes.Buffer
+	console, err := NewConsole(log, db, cfg, "nick", testChannel, strings.NewReader(input), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Run stops the modules, which waits for the replies to be printed
+	if err := console.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestConsoleCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"channel", "!cooldowns\n/quit\n", "[" + testChannel + "] <" + testNick + "> !cooldowns - no active cooldowns\n"},
+		{"query", "/query\n!cooldowns\n/quit\n", "[nick] <" + testNick + "> !cooldowns - no active cooldowns\n"},
+		{"notice", "!help help\n/quit\n", "[nick] -" + testNick + "- !help - !help [command]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := runConsole(t, tt.input)
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("console printed\n%s\nwant %q", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsoleClock(t *testing.T) {
+	out := runConsole(t, "/set 2026-10-19 00:00\n/advance 90m\n/time\n/quit\n")
+	if !strings.Contains(out, "the time is 2026-10-19 01:30") {
+		t.Errorf("console printed\n%s\nwant the clock moved to 2026-10-19 01:30", out)
+	}
+}
@@ -0,0 +1,131 @@
+package gofibot
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/ratelimit"
+	"github.com/lrstanley/girc"
+)
+
+const cooldownPruneInterval time.Duration = time.Minute
+
+// cooldown is a single users cooldown for a command
+type cooldown struct {
+	Hostmask string
+	Command  string
+	Until    time.Time
+	warned   bool
+}
+
+// cooldowns limits how often users may run commands and how many
+// commands are run on a channel
+type cooldowns struct {
+	cfg config.RateLimitConfiguration
+
+	mu        sync.Mutex
+	users     map[string]*cooldown
+	channels  map[string]*ratelimit.TokenBucket
+	lastPrune time.Time
+}
+
+func newCooldowns(cfg config.RateLimitConfiguration) *cooldowns {
+	return &cooldowns{
+		cfg:       cfg,
+		users:     make(map[string]*cooldown),
+		channels:  make(map[string]*ratelimit.TokenBucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// setConfig replaces the rate limit configuration, channel limits
+// start over
+func (c *cooldowns) setConfig(cfg config.RateLimitConfiguration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = cfg
+	c.channels = make(map[string]*ratelimit.TokenBucket)
+}
+
+// duration returns the cooldown of command, configured cooldowns
+// override the module default
+func (c *cooldowns) duration(command string, moduleDefault time.Duration) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if seconds, ok := c.cfg.Commands[command]; ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return moduleDefault
+}
+
+// allow checks if hostmask may run command on channel now. If not, it
+// returns how long the user has to wait and if the user should be told
+// about it. Channel is empty for private messages.
+func (c *cooldowns) allow(hostmask, channel, command string, duration time.Duration, now time.Time) (ok bool, wait time.Duration, warn bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastPrune) > cooldownPruneInterval {
+		c.prune(now)
+	}
+
+	key := hostmask + " " + command
+	if cd, found := c.users[key]; found && now.Before(cd.Until) {
+		warn = c.cfg.Notice && !cd.warned
+		cd.warned = true
+		return false, cd.Until.Sub(now), warn
+	}
+
+	if channel != "" && c.cfg.ChannelRate > 0 {
+		chKey := girc.ToRFC1459(channel)
+		bucket, found := c.channels[chKey]
+		if !found {
+			bucket = ratelimit.NewTokenBucket(c.cfg.ChannelRate, c.cfg.ChannelBurst, now)
+			c.channels[chKey] = bucket
+		}
+		if !bucket.Allow(now) {
+			return false, bucket.Wait(now), false
+		}
+	}
+
+	if duration > 0 {
+		c.users[key] = &cooldown{
+			Hostmask: hostmask,
+			Command:  command,
+			Until:    now.Add(duration),
+		}
+	}
+	return true, 0, false
+}
+
+// active returns the cooldowns that have not expired, soonest first
+func (c *cooldowns) active(now time.Time) []cooldown {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune(now)
+	list := make([]cooldown, 0, len(c.users))
+	for _, cd := range c.users {
+		list = append(list, *cd)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Until.Before(list[j].Until)
+	})
+	return list
+}
+
+// prune removes expired cooldowns and full channel buckets
+func (c *cooldowns) prune(now time.Time) {
+	for key, cd := range c.users {
+		if !now.Before(cd.Until) {
+			delete(c.users, key)
+		}
+	}
+	for key, bucket := range c.channels {
+		if bucket.Full(now) {
+			delete(c.channels, key)
+		}
+	}
+	c.lastPrune = now
+}
@@ -0,0 +1,101 @@
+package gofibot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+)
+
+func TestCooldownDuration(t *testing.T) {
+	c := newCooldowns(config.RateLimitConfiguration{Commands: map[string]int{"w": 10, "date": 0}})
+	tests := []struct {
+		command string
+		want    time.Duration
+	}{
+		{"w", 10 * time.Second},
+		{"date", 0},
+		{"stats", 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := c.duration(tt.command, 30*time.Second); got != tt.want {
+			t.Errorf("duration(%s) = %s, want %s", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestCooldownAllow(t *testing.T) {
+	c := newCooldowns(config.RateLimitConfiguration{Notice: true})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	allow := func(hostmask, command string, at time.Duration) (bool, time.Duration, bool) {
+		return c.allow(hostmask, testChannel, command, 10*time.Second, now.Add(at))
+	}
+
+	if ok, _, _ := allow("a!a@host", "w", 0); !ok {
+		t.Fatal("first run was limited")
+	}
+	ok, wait, warn := allow("a!a@host", "w", 4*time.Second)
+	if ok || wait != 6*time.Second || !warn {
+		t.Errorf("run on cooldown = %v, %s, %v, want false, 6s, true", ok, wait, warn)
+	}
+	// users are told about the cooldown once
+	if ok, _, warn := allow("a!a@host", "w", 5*time.Second); ok || warn {
+		t.Errorf("second run on cooldown = %v, warn %v", ok, warn)
+	}
+	if ok, _, _ := allow("b!b@host", "w", 5*time.Second); !ok {
+		t.Error("cooldown of another user applied")
+	}
+	if ok, _, _ := allow("a!a@host", "date", 5*time.Second); !ok {
+		t.Error("cooldown of another command applied")
+	}
+	if ok, _, _ := allow("a!a@host", "w", 10*time.Second); !ok {
+		t.Error("run after the cooldown was limited")
+	}
+	if ok, _, warn := allow("a!a@host", "w", 11*time.Second); ok || !warn {
+		t.Errorf("new cooldown = %v, warn %v, want false, true", ok, warn)
+	}
+
+	if active := c.active(now.Add(11 * time.Second)); len(active) != 3 {
+		t.Errorf("%d active cooldowns, want 3: %v", len(active), active)
+	}
+	if active := c.active(now.Add(time.Minute)); len(active) != 0 {
+		t.Errorf("expired cooldowns are active: %v", active)
+	}
+}
+
+func TestCooldownNoNotice(t *testing.T) {
+	c := newCooldowns(config.RateLimitConfiguration{})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	c.allow("a!a@host", testChannel, "w", time.Second, now)
+	if ok, _, warn := c.allow("a!a@host", testChannel, "w", time.Second, now); ok || warn {
+		t.Errorf("run on cooldown = %v, warn %v, want false, false", ok, warn)
+	}
+}
+
+func TestChannelLimit(t *testing.T) {
+	c := newCooldowns(config.RateLimitConfiguration{ChannelRate: 1, ChannelBurst: 2, Notice: true})
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	allow := func(hostmask, channel string) (bool, time.Duration, bool) {
+		return c.allow(hostmask, channel, "date", 0, now)
+	}
+
+	for _, nick := range []string{"a!a@host", "b!b@host"} {
+		if ok, _, _ := allow(nick, testChannel); !ok {
+			t.Fatalf("run of %s within the burst was limited", nick)
+		}
+	}
+	ok, wait, warn := allow("c!c@host", testChannel)
+	if ok || wait != time.Second || warn {
+		t.Errorf("run over the channel limit = %v, %s, %v, want false, 1s, false", ok, wait, warn)
+	}
+	if ok, _, _ := allow("c!c@host", "#other"); !ok {
+		t.Error("limit of another channel applied")
+	}
+	if ok, _, _ := allow("c!c@host", ""); !ok {
+		t.Error("channel limit applied to a private message")
+	}
+	now = now.Add(time.Second)
+	if ok, _, _ := allow("c!c@host", testChannel); !ok {
+		t.Error("channel limit did not refill")
+	}
+}
@@ -0,0 +1,590 @@
+package gofibot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/acl"
+	"github.com/huqa/gofibot/internal/pkg/cmdline"
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/modules"
+)
+
+const (
+	coreModuleName string = "core"
+
+	cooldownsCommand string = "cooldowns"
+	aclCommand       string = "acl"
+	ignoreCommand    string = "ignore"
+	unignoreCommand  string = "unignore"
+	moduleCommand    string = "module"
+	helpCommand      string = "help"
+	aliasCommand     string = "alias"
+	workersCommand   string = "workers"
+	scheduleCommand  string = "schedule"
+	reloadCommand    string = "reload"
+
+	// longer help output is sent as a private notice
+	maxInlineHelp int = 200
+)
+
+// coreModule implements the built-in administration commands of
+// ModuleService. Its output is sent with high priority.
+type coreModule struct {
+	log       logger.Logger
+	service   *ModuleService
+	responder modules.Responder
+	commands  []string
+	help      []modules.CommandHelp
+}
+
+func newCoreModule(log logger.Logger, service *ModuleService, responder modules.Responder) *coreModule {
+	return &coreModule{
+		log:       log.Named("coremodule"),
+		service:   service,
+		responder: responder,
+		commands:  []string{helpCommand, cooldownsCommand, aclCommand, ignoreCommand, unignoreCommand, moduleCommand, aliasCommand, workersCommand, scheduleCommand, reloadCommand},
+		help: []modules.CommandHelp{
+			{
+				Command:     helpCommand,
+				Description: "lists the commands you can use here or shows help for one command",
+				Usage:       "[command]",
+				Examples:    []string{"help", "help w"},
+			},
+			{
+				Command:     cooldownsCommand,
+				Description: "lists active command cooldowns",
+			},
+			{
+				Command:     aclCommand,
+				Description: "manages user roles",
+				Usage:       "add <mask|$a:account> <role> | del <mask> | list",
+				Examples:    []string{"acl add *!*@example.com trusted", "acl del *!*@example.com"},
+			},
+			{
+				Command:     ignoreCommand,
+				Description: "ignores a user in all modules except the listed ones, without arguments lists ignored users",
+				Usage:       "[<mask|nick|$a:account> [except <module>[,<module>...]]]",
+				Examples:    []string{"ignore otherbot except stats"},
+			},
+			{
+				Command:     unignoreCommand,
+				Description: "stops ignoring a user",
+				Usage:       "<mask|nick|$a:account>",
+			},
+			{
+				Command:     moduleCommand,
+				Description: "enables or disables a module on a channel or everywhere with *",
+				Usage:       "enable|disable <name> [#channel|*] | list [#channel]",
+				Examples:    []string{"module disable urltitle #mychannel", "module list"},
+			},
+			{
+				Command:     aliasCommand,
+				Description: "adds a new name for a command, optionally with arguments",
+				Usage:       "add <alias> <command> [args...] | del <alias> | list",
+				Examples:    []string{"alias add s w", "alias add tre w tampere"},
+			},
+			{
+				Command:     workersCommand,
+				Description: "shows how many events are waiting to be handled and how many were dropped",
+			},
+			{
+				Command:     scheduleCommand,
+				Description: "lists scheduled jobs with their next and last runs",
+				Usage:       "list",
+			},
+			{
+				Command:     reloadCommand,
+				Description: "reads the configuration file again without reconnecting",
+			},
+		},
+	}
+}
+
+// Name returns the name of this module
+func (m *coreModule) Name() string {
+	return coreModuleName
+}
+
+// Init initializes core module
+func (m *coreModule) Init() error {
+	m.log.Info("Init")
+	return nil
+}
+
+// Stop is run when module is stopped
+func (m *coreModule) Stop() error {
+	return nil
+}
+
+// Handle runs core commands
+func (m *coreModule) Handle(c *modules.Context) error {
+	switch c.Command {
+	case helpCommand:
+		return m.showHelp(c)
+	case cooldownsCommand:
+		return m.listCooldowns(c)
+	case aclCommand:
+		return m.manageACL(c)
+	case ignoreCommand:
+		return m.ignoreUser(c)
+	case unignoreCommand:
+		return m.unignoreUser(c)
+	case moduleCommand:
+		return m.switchModule(c)
+	case aliasCommand:
+		return m.manageAliases(c)
+	case workersCommand:
+		return m.showWorkers(c)
+	case scheduleCommand:
+		return m.listSchedule(c)
+	case reloadCommand:
+		return m.reloadConfig(c)
+	}
+	return nil
+}
+
+// MinRole returns the role needed to run command
+func (m *coreModule) MinRole(command string) acl.Role {
+	if command == helpCommand {
+		return acl.RoleUser
+	}
+	return acl.RoleAdmin
+}
+
+// showHelp handles !help [command]. Without arguments it lists the
+// commands the caller may run here.
+func (m *coreModule) showHelp(c *modules.Context) error {
+	role := m.service.role(c.Event)
+	prefix := m.service.prefix(c.Channel)
+	if len(c.Args) == 0 {
+		list := make([]string, 0)
+		for _, md := range m.service.modules {
+			for _, command := range md.Commands() {
+				// aliases are listed with the command they alias
+				if h, ok := modules.FindHelp(md, command); ok && h.Command != command {
+					continue
+				}
+				if m.service.canRun(c.Event, role, command, md) {
+					list = append(list, prefix+command)
+				}
+			}
+		}
+		m.replyLong(c, []string{fmt.Sprintf("!help - commands: %s - %shelp <command> for details", strings.Join(list, ", "), prefix)})
+		return nil
+	}
+
+	command, _ := m.service.resolve(strings.TrimPrefix(c.Args[0], prefix), nil)
+	md := m.service.Command(command)
+	if md == nil || !m.service.canRun(c.Event, role, command, md) {
+		m.reply(c, "!help - no such command: "+command)
+		return nil
+	}
+	h, ok := modules.FindHelp(md, command)
+	if !ok {
+		m.reply(c, fmt.Sprintf("!help - %s%s: no help available", prefix, command))
+		return nil
+	}
+	usage := prefix + h.Command
+	if argsUsage := h.ArgsUsage(); argsUsage != "" {
+		usage += " " + argsUsage
+	}
+	lines := []string{fmt.Sprintf("!help - %s: %s", usage, h.Description)}
+	if len(h.Aliases) > 0 {
+		lines = append(lines, "aliases: "+prefix+strings.Join(h.Aliases, ", "+prefix))
+	}
+	if len(h.Examples) > 0 {
+		lines = append(lines, "examples: "+prefix+strings.Join(h.Examples, ", "+prefix))
+	}
+	m.replyLong(c, lines)
+	return nil
+}
+
+// listCooldowns lists active command cooldowns
+func (m *coreModule) listCooldowns(c *modules.Context) error {
+	now := m.service.clock.Now()
+	active := m.service.cooldowns.active(now)
+	if len(active) == 0 {
+		m.reply(c, "!cooldowns - no active cooldowns")
+		return nil
+	}
+	entries := make([]string, 0, len(active))
+	for _, cd := range active {
+		entries = append(entries, fmt.Sprintf("%s %s%s (%s)", cd.Hostmask, m.service.prefix(""), cd.Command, cd.Until.Sub(now).Round(time.Second)))
+	}
+	m.reply(c, fmt.Sprintf("!cooldowns - %d active: %s", len(active), strings.Join(entries, ", ")))
+	return nil
+}
+
+// manageACL handles !acl add <mask> <role>, !acl del <mask> and !acl list.
+// Users can only manage roles lower than their own unless they are owners.
+func (m *coreModule) manageACL(c *modules.Context) error {
+	usage := "!acl - usage: acl add <mask|$a:account> <role> | acl del <mask> | acl list"
+	if len(c.Args) == 0 {
+		m.reply(c, usage)
+		return nil
+	}
+	callerRole := m.service.role(c.Event)
+	canManage := func(role acl.Role) bool {
+		return acl.CanManage(callerRole, role)
+	}
+
+	switch c.Args[0] {
+	case "list":
+		entries := m.service.acl.Entries()
+		if len(entries) == 0 {
+			m.reply(c, "!acl - no entries")
+			return nil
+		}
+		list := make([]string, 0, len(entries))
+		for _, e := range entries {
+			list = append(list, fmt.Sprintf("%s (%s)", e.Mask, e.Role))
+		}
+		m.reply(c, "!acl - "+strings.Join(list, ", "))
+	case "add":
+		if len(c.Args) != 3 {
+			m.reply(c, usage)
+			return nil
+		}
+		if acl.MatchesEveryone(c.Args[1]) {
+			m.reply(c, "!acl - can't give everyone a role")
+			return nil
+		}
+		role, err := acl.ParseRole(c.Args[2])
+		if err != nil {
+			m.reply(c, "!acl - "+err.Error())
+			return nil
+		}
+		if existing, ok := m.service.acl.Get(c.Args[1]); !canManage(role) || (ok && !canManage(existing.Role)) {
+			m.reply(c, "!acl - permission denied")
+			return nil
+		}
+		e, err := m.service.acl.Add(c.Args[1], role, c.Source.String())
+		if err != nil {
+			m.reply(c, "!acl - can't add entry")
+			return err
+		}
+		m.reply(c, fmt.Sprintf("!acl - %s is now %s", e.Mask, e.Role))
+	case "del":
+		if len(c.Args) != 2 {
+			m.reply(c, usage)
+			return nil
+		}
+		existing, ok := m.service.acl.Get(c.Args[1])
+		if !ok {
+			m.reply(c, "!acl - no such entry: "+acl.NormalizeMask(c.Args[1]))
+			return nil
+		}
+		if !canManage(existing.Role) {
+			m.reply(c, "!acl - permission denied")
+			return nil
+		}
+		if _, err := m.service.acl.Delete(existing.Mask); err != nil {
+			m.reply(c, "!acl - can't delete entry")
+			return err
+		}
+		m.reply(c, "!acl - deleted "+existing.Mask)
+	default:
+		m.reply(c, usage)
+	}
+	return nil
+}
+
+// ignoreUser handles !ignore <mask> [except <module>[,<module>...]],
+// without arguments it lists ignored masks
+func (m *coreModule) ignoreUser(c *modules.Context) error {
+	if len(c.Args) == 0 {
+		entries := m.service.ignore.Entries()
+		if len(entries) == 0 {
+			m.reply(c, "!ignore - nobody is ignored")
+			return nil
+		}
+		list := make([]string, 0, len(entries))
+		for _, e := range entries {
+			if len(e.Except) > 0 {
+				list = append(list, fmt.Sprintf("%s (except %s)", e.Mask, strings.Join(e.Except, ",")))
+				continue
+			}
+			list = append(list, e.Mask)
+		}
+		m.reply(c, "!ignore - "+strings.Join(list, ", "))
+		return nil
+	}
+
+	var except []string
+	switch {
+	case len(c.Args) == 3 && c.Args[1] == "except":
+		except = strings.Split(c.Args[2], ",")
+	case len(c.Args) != 1:
+		m.reply(c, "!ignore - usage: ignore [<mask|nick|$a:account> [except <module>[,<module>...]]]")
+		return nil
+	}
+	callerRole := m.service.role(c.Event)
+	if acl.MatchesEveryone(c.Args[0]) || acl.Match(c.Args[0], c.Source.String(), c.Account) {
+		m.reply(c, "!ignore - can't ignore everyone or yourself")
+		return nil
+	}
+	if existing, ok := m.service.acl.Get(c.Args[0]); ok && !acl.CanManage(callerRole, existing.Role) {
+		m.reply(c, "!ignore - permission denied")
+		return nil
+	}
+	if existing, ok := m.service.ignore.Get(c.Args[0]); ok && !acl.CanManage(callerRole, existing.Role) {
+		m.reply(c, "!ignore - permission denied")
+		return nil
+	}
+	e, err := m.service.ignore.Add(c.Args[0], except, c.Source.String(), callerRole)
+	if err != nil {
+		m.reply(c, "!ignore - can't ignore "+c.Args[0])
+		return err
+	}
+	m.reply(c, "!ignore - ignoring "+e.Mask)
+	return nil
+}
+
+// unignoreUser handles !unignore <mask>
+func (m *coreModule) unignoreUser(c *modules.Context) error {
+	if len(c.Args) != 1 {
+		m.reply(c, "!unignore - usage: unignore <mask|nick|$a:account>")
+		return nil
+	}
+	existing, ok := m.service.ignore.Get(c.Args[0])
+	if !ok {
+		m.reply(c, "!unignore - not ignored: "+acl.NormalizeMask(c.Args[0]))
+		return nil
+	}
+	if !acl.CanManage(m.service.role(c.Event), existing.Role) {
+		m.reply(c, "!unignore - permission denied")
+		return nil
+	}
+	if _, err := m.service.ignore.Delete(existing.Mask); err != nil {
+		m.reply(c, "!unignore - can't unignore "+c.Args[0])
+		return err
+	}
+	m.reply(c, "!unignore - stopped ignoring "+acl.NormalizeMask(c.Args[0]))
+	return nil
+}
+
+// switchModule handles !module enable|disable <name> [#channel|*] and
+// !module list [#channel]. The channel defaults to the current one.
+func (m *coreModule) switchModule(c *modules.Context) error {
+	usage := "!module - usage: module enable|disable <name> [#channel|*] | module list [#channel]"
+	if len(c.Args) == 0 {
+		m.reply(c, usage)
+		return nil
+	}
+	channel := c.Channel
+	switch c.Args[0] {
+	case "list":
+		if len(c.Args) > 1 {
+			channel = c.Args[1]
+		}
+		if channel == "" {
+			m.reply(c, usage)
+			return nil
+		}
+		list := make([]string, 0, len(m.service.modules))
+		for _, md := range m.service.modules {
+			state := "on"
+			if m.service.breaker.Open(md.Name(), time.Now()) {
+				state = "failing"
+			} else if !m.service.enabled(channel, md) {
+				state = "off"
+			}
+			list = append(list, fmt.Sprintf("%s (%s)", md.Name(), state))
+		}
+		m.reply(c, fmt.Sprintf("!module - %s: %s", channel, strings.Join(list, ", ")))
+	case "enable", "disable":
+		if len(c.Args) < 2 || len(c.Args) > 3 {
+			m.reply(c, usage)
+			return nil
+		}
+		if len(c.Args) == 3 {
+			channel = c.Args[2]
+		}
+		if channel == "" {
+			m.reply(c, usage)
+			return nil
+		}
+		md := m.service.Module(c.Args[1])
+		if md == nil {
+			m.reply(c, "!module - no such module: "+c.Args[1])
+			return nil
+		}
+		if md.Name() == coreModuleName {
+			m.reply(c, "!module - core module can't be disabled")
+			return nil
+		}
+		enabled := c.Args[0] == "enable"
+		if err := m.service.switches.Set(channel, md.Name(), enabled); err != nil {
+			m.reply(c, "!module - can't save module state")
+			return err
+		}
+		if enabled {
+			// enabling also brings back a module disabled for failing
+			m.service.breaker.Reset(md.Name())
+		}
+		m.reply(c, fmt.Sprintf("!module - %s %sd on %s", md.Name(), c.Args[0], channel))
+	default:
+		m.reply(c, usage)
+	}
+	return nil
+}
+
+// showWorkers shows the load of the event workers
+func (m *coreModule) showWorkers(c *modules.Context) error {
+	stats := m.service.workers.Stats()
+	m.reply(c, fmt.Sprintf("!workers - %d workers, %d queued (max %d), %d handled, %d dropped",
+		stats.Workers, stats.Queued, stats.MaxQueued, stats.Processed, stats.Dropped))
+	return nil
+}
+
+// listSchedule handles !schedule list
+func (m *coreModule) listSchedule(c *modules.Context) error {
+	if len(c.Args) != 1 || c.Args[0] != "list" {
+		m.reply(c, "!schedule - usage: schedule list")
+		return nil
+	}
+	entries := m.service.scheduler.Entries()
+	if len(entries) == 0 {
+		m.reply(c, "!schedule - no scheduled jobs")
+		return nil
+	}
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.In(m.service.location).Format("2.1.2006 15:04")
+	}
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		lines = append(lines, fmt.Sprintf("!schedule - %s (%s) next %s, last %s", e.Name, e.Spec, format(e.Next), format(e.LastRun)))
+	}
+	m.replyLong(c, lines)
+	return nil
+}
+
+// reloadConfig handles !reload
+func (m *coreModule) reloadConfig(c *modules.Context) error {
+	if m.service.reload == nil {
+		m.reply(c, "!reload - reloading is not available")
+		return nil
+	}
+	if err := m.service.reload(); err != nil {
+		m.reply(c, "!reload - "+err.Error())
+		return nil
+	}
+	m.reply(c, "!reload - configuration reloaded")
+	return nil
+}
+
+// manageAliases handles !alias add <alias> <command> [args...],
+// !alias del <alias> and !alias list
+func (m *coreModule) manageAliases(c *modules.Context) error {
+	usage := "!alias - usage: alias add <alias> <command> [args...] | alias del <alias> | alias list"
+	if len(c.Args) == 0 {
+		m.reply(c, usage)
+		return nil
+	}
+	switch c.Args[0] {
+	case "list":
+		entries := m.service.aliases.Entries()
+		if len(entries) == 0 {
+			m.reply(c, "!alias - no aliases")
+			return nil
+		}
+		list := make([]string, 0, len(entries))
+		for _, e := range entries {
+			list = append(list, fmt.Sprintf("%s -> %s", e.Alias, cmdline.Join(e.Expansion)))
+		}
+		m.reply(c, "!alias - "+strings.Join(list, ", "))
+	case "add":
+		if len(c.Args) < 3 {
+			m.reply(c, usage)
+			return nil
+		}
+		alias, target := c.Args[1], c.Args[2]
+		if _, ok := m.service.commands[alias]; ok {
+			m.reply(c, "!alias - "+alias+" is already a command")
+			return nil
+		}
+		if _, ok := m.service.commands[target]; !ok {
+			m.reply(c, "!alias - no such command: "+target)
+			return nil
+		}
+		if err := m.service.aliases.Add(alias, c.Args[2:]); err != nil {
+			m.reply(c, "!alias - can't add alias")
+			return err
+		}
+		m.reply(c, fmt.Sprintf("!alias - %s -> %s", alias, cmdline.Join(c.Args[2:])))
+	case "del":
+		if len(c.Args) != 2 {
+			m.reply(c, usage)
+			return nil
+		}
+		ok, err := m.service.aliases.Delete(c.Args[1])
+		if err != nil {
+			m.reply(c, "!alias - can't delete alias")
+			return err
+		}
+		if !ok {
+			m.reply(c, "!alias - no such alias: "+c.Args[1])
+			return nil
+		}
+		m.reply(c, "!alias - deleted "+c.Args[1])
+	default:
+		m.reply(c, usage)
+	}
+	return nil
+}
+
+func (m *coreModule) reply(c *modules.Context, message string) {
+	m.responder.Reply(c.Event, message)
+}
+
+// replyLong replies in place if lines is one short line, otherwise
+// lines are sent to the caller as a private notice
+func (m *coreModule) replyLong(c *modules.Context, lines []string) {
+	if len(lines) == 1 && len(lines[0]) <= maxInlineHelp {
+		m.reply(c, lines[0])
+		return
+	}
+	for _, line := range lines {
+		m.responder.Notice(c.Source.Name, line)
+	}
+}
+
+// Description returns what this module does
+func (m *coreModule) Description() string {
+	return "built-in help and administration commands"
+}
+
+// Help returns help for commands of this module
+func (m *coreModule) Help() []modules.CommandHelp {
+	return m.help
+}
+
+// Commands returns commands used by this module
+func (m *coreModule) Commands() []string {
+	return m.commands
+}
+
+// Events returns event types used by this module
+func (m *coreModule) Events() []string {
+	return []string{modules.EventPrivmsg}
+}
+
+// Global returns true if this module is a global command
+func (m *coreModule) Global() bool {
+	return false
+}
+
+// Contexts returns where this module accepts messages from
+func (m *coreModule) Contexts() modules.MessageContext {
+	return modules.ContextAll
+}
+
+// Cooldown returns how often a user may run commands of this module
+func (m *coreModule) Cooldown() time.Duration {
+	return 0
+}
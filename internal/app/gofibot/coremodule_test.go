@@ -0,0 +1,154 @@
+package gofibot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/huqa/gofibot/internal/pkg/acl"
+	"github.com/huqa/gofibot/internal/pkg/modules"
+)
+
+func TestManageACL(t *testing.T) {
+	m, sender, stop := newTestModuleService(t)
+	defer stop()
+	if err := m.RegisterModules(); err != nil {
+		t.Fatal(err)
+	}
+	m.acl.SetOwners([]string{"owner!*@*"})
+	if _, err := m.acl.Add("admin", acl.RoleAdmin, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.acl.Add("other", acl.RoleAdmin, "owner"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		hostmask, message, reply string
+	}{
+		{"admin!a@host", "!acl add * ignored", "can't give everyone a role"},
+		{"admin!a@host", "!acl add *!*@* trusted", "can't give everyone a role"},
+		{"owner!o@host", "!acl add $a:* trusted", "can't give everyone a role"},
+		{"admin!a@host", "!acl add nick admin", "permission denied"},
+		{"admin!a@host", "!acl add other trusted", "permission denied"},
+		{"admin!a@host", "!acl del other", "permission denied"},
+		{"admin!a@host", "!acl add nick trusted", "nick!*@* is now trusted"},
+		{"owner!o@host", "!acl add other trusted", "other!*@* is now trusted"},
+		{"user!u@host", "!acl add nick admin", ""},
+	}
+	for _, tt := range tests {
+		sender.reset()
+		privmsg(m, tt.hostmask, testChannel, tt.message)
+		want := []string{}
+		if tt.reply != "" {
+			want = []string{"PRIVMSG " + testChannel + " !acl - " + tt.reply}
+		}
+		if got := sender.Lines(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: %s replied %q, want %q", tt.hostmask, tt.message, got, want)
+		}
+	}
+
+	if got := m.acl.Role("someone!s@host", ""); got != acl.RoleUser {
+		t.Errorf("role of everyone is %s", got)
+	}
+	if got := m.acl.Role("nick!n@host", ""); got != acl.RoleTrusted {
+		t.Errorf("role of nick is %s, want trusted", got)
+	}
+}
+
+func TestManageAliasesQuoted(t *testing.T) {
+	m, sender, stop := newTestModuleService(t)
+	defer stop()
+	var got []string
+	md := &testModule{
+		name:     "weather",
+		commands: []string{"w"},
+		events:   []string{modules.EventPrivmsg},
+		handle: func(c *modules.Context) error {
+			got = c.Args
+			return nil
+		},
+	}
+	if err := m.RegisterModules(md); err != nil {
+		t.Fatal(err)
+	}
+	m.acl.SetOwners([]string{"owner!*@*"})
+
+	privmsg(m, "owner!o@host", testChannel, `!alias add ny w "new york"`)
+	privmsg(m, "user!u@host", testChannel, "!ny --days=2")
+	if want := []string{"new york", "--days=2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("alias ran with %q, want %q", got, want)
+	}
+	privmsg(m, "owner!o@host", testChannel, "!alias list")
+	want := []string{
+		"PRIVMSG " + testChannel + ` !alias - ny -> w "new york"`,
+		"PRIVMSG " + testChannel + ` !alias - ny -> w "new york"`,
+	}
+	if lines := sender.Lines(); !reflect.DeepEqual(lines, want) {
+		t.Errorf("sent %q, want %q", lines, want)
+	}
+}
+
+func TestHelpFilters(t *testing.T) {
+	m, sender, stop := newTestModuleService(t)
+	defer stop()
+	command := func(name, command string, contexts modules.MessageContext, aliases ...string) *testModule {
+		return &testModule{
+			name:     name,
+			commands: append([]string{command}, aliases...),
+			events:   []string{modules.EventPrivmsg},
+			contexts: contexts,
+			help:     []modules.CommandHelp{{Command: command, Aliases: aliases, Description: name + " things"}},
+		}
+	}
+	err := m.RegisterModules(
+		command("public", "pub", modules.ContextAll),
+		command("trusted", "tr", modules.ContextAll),
+		command("channel", "ch", modules.ContextChannel),
+		command("disabled", "off", modules.ContextAll),
+		command("stats", "stats", modules.ContextAll, "toptod"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.moduleRoles = map[string]acl.Role{"trusted": acl.RoleTrusted}
+	if _, err := m.acl.Add("trusty", acl.RoleTrusted, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.switches.Set(testChannel, "disabled", false); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, hostmask, target, message, reply string
+	}{
+		{"user on channel", "user!u@host", testChannel, "!help",
+			"PRIVMSG " + testChannel + " !help - commands: !help, !pub, !ch, !stats - !help <command> for details"},
+		{"trusted on channel", "trusty!t@host", testChannel, "!help",
+			"PRIVMSG " + testChannel + " !help - commands: !help, !pub, !tr, !ch, !stats - !help <command> for details"},
+		{"user in private", "user!u@host", testNick, "!help",
+			"PRIVMSG user !help - commands: !help, !pub, !off, !stats - !help <command> for details"},
+		{"command of a role", "user!u@host", testChannel, "!help tr",
+			"PRIVMSG " + testChannel + " !help - no such command: tr"},
+		{"disabled command", "user!u@host", testChannel, "!help off",
+			"PRIVMSG " + testChannel + " !help - no such command: off"},
+		{"channel command in private", "user!u@host", testNick, "!help ch",
+			"PRIVMSG user !help - no such command: ch"},
+		{"command", "trusty!t@host", testChannel, "!help tr",
+			"PRIVMSG " + testChannel + " !help - !tr: trusted things"},
+	}
+	for _, tt := range tests {
+		sender.reset()
+		privmsg(m, tt.hostmask, tt.target, tt.message)
+		if got := sender.Lines(); !reflect.DeepEqual(got, []string{tt.reply}) {
+			t.Errorf("%s: %s replied %q, want %q", tt.name, tt.message, got, tt.reply)
+		}
+	}
+
+	// help of an alias is the help of its command
+	sender.reset()
+	privmsg(m, "user!u@host", testChannel, "!help toptod")
+	want := []string{"NOTICE user !help - !stats: stats things", "NOTICE user aliases: !toptod"}
+	if got := sender.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("help of an alias sent %q, want %q", got, want)
+	}
+}
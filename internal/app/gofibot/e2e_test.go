@@ -0,0 +1,317 @@
+package gofibot
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/database"
+	"github.com/huqa/gofibot/internal/pkg/irctest"
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/scheduler"
+	"github.com/lrstanley/girc"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+const (
+	testNick    string = "gofibot"
+	testChannel string = "#gofibot"
+	// registration takes a while as girc waits before it is connected
+	testTimeout time.Duration = 10 * time.Second
+)
+
+// testBot is a bot connected to a fake server
+type testBot struct {
+	*irctest.Server
+	t       *testing.T
+	service *IRCService
+	clock   *scheduler.FakeClock
+	db      *bolt.DB
+	dir     string
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// newTestBot starts a bot with the default modules against a fake server,
+// configure may change the configuration before the bot starts
+func newTestBot(t *testing.T, configure func(cfg *config.BotConfiguration)) *testBot {
+	t.Helper()
+	server, err := irctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "gofibot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host, port := server.Addr()
+	cfg := config.BotConfiguration{
+		Nick:     testNick,
+		Ident:    testNick,
+		Realname: testNick,
+		Server:   host,
+		Port:     port,
+		Channels: []string{testChannel},
+		Prefix:   "!",
+		Location: "UTC",
+		Reconnect: config.ReconnectConfiguration{
+			InitialDelay: 1,
+			MaxDelay:     1,
+			Multiplier:   1,
+		},
+		Flood: config.FloodConfiguration{
+			Rate:        100,
+			Burst:       100,
+			GlobalRate:  100,
+			GlobalBurst: 100,
+			MaxLines:    5,
+			QueueSize:   100,
+		},
+		Execution: config.ExecutionConfiguration{
+			Timeout:   5,
+			Workers:   2,
+			QueueSize: 10,
+		},
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+
+	log := &logger.LogWrapper{SugaredLogger: zap.NewNop().Sugar()}
+	service, err := NewIRCService(log, db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	is := service.(*IRCService)
+	clock := scheduler.NewFakeClock(time.Date(2026, 10, 18, 23, 59, 0, 0, time.UTC))
+	is.moduleService.SetClock(clock)
+	if err := is.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	bot := &testBot{
+		Server:  server,
+		t:       t,
+		service: is,
+		clock:   clock,
+		db:      db,
+		dir:     dir,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		defer close(bot.done)
+		is.Run(ctx)
+	}()
+	return bot
+}
+
+// stop shuts the bot and the server down
+func (b *testBot) stop() {
+	b.cancel()
+	b.service.Stop()
+	b.Server.Close()
+	select {
+	case <-b.done:
+	case <-time.After(testTimeout):
+		b.t.Error("bot did not stop")
+	}
+	b.db.Close()
+	os.RemoveAll(b.dir)
+}
+
+// joined waits until the bot is on channel
+func (b *testBot) joined(channel string) {
+	b.t.Helper()
+	if err := b.WaitJoined(channel, testTimeout); err != nil {
+		b.t.Fatalf("bot did not join %s: %v", channel, err)
+	}
+}
+
+// say sends message to target from nick
+func (b *testBot) say(nick, target, message string) {
+	b.t.Helper()
+	if err := b.Privmsg(nick, target, message); err != nil {
+		b.t.Fatal(err)
+	}
+}
+
+// expect returns the next message the bot sends to target
+func (b *testBot) expect(target string) string {
+	b.t.Helper()
+	message, err := b.ExpectMessage(target, testTimeout)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	return message
+}
+
+func TestRegistration(t *testing.T) {
+	bot := newTestBot(t, nil)
+	defer bot.stop()
+
+	if err := bot.WaitRegistered(testTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if nick := bot.Nick(); nick != testNick {
+		t.Errorf("registered as %q, want %q", nick, testNick)
+	}
+	user, err := bot.Expect(testTimeout, func(e *girc.Event) bool {
+		return e.Command == girc.USER
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Params[0] != testNick {
+		t.Errorf("ident is %q, want %q", user.Params[0], testNick)
+	}
+}
+
+func TestJoinChannels(t *testing.T) {
+	bot := newTestBot(t, func(cfg *config.BotConfiguration) {
+		cfg.Channels = []string{testChannel, "#other"}
+	})
+	defer bot.stop()
+
+	bot.joined(testChannel)
+	bot.joined("#other")
+	if bot.Joined("#unknown") {
+		t.Error("joined a channel that is not configured")
+	}
+}
+
+func TestCommandDispatch(t *testing.T) {
+	bot := newTestBot(t, func(cfg *config.BotConfiguration) {
+		cfg.Owners = []string{"owner!*@*"}
+		cfg.Prefixes = map[string][]string{testChannel: {"!", "."}}
+	})
+	defer bot.stop()
+	bot.joined(testChannel)
+
+	// aliases are added by the owner
+	bot.say("owner", testChannel, "!alias add paiva pvm")
+	if reply := bot.expect(testChannel); reply != "!alias - paiva -> pvm" {
+		t.Fatalf("unexpected reply to alias add %q", reply)
+	}
+
+	tests := []struct {
+		name    string
+		nick    string
+		target  string
+		message string
+		replyTo string
+	}{
+		{"prefix", "alice", testChannel, "!pvm", testChannel},
+		{"channel prefix", "erin", testChannel, ".pvm", testChannel},
+		{"alias", "bob", testChannel, "!paiva", testChannel},
+		{"alias with channel prefix", "frank", testChannel, ".paiva", testChannel},
+		{"addressed", "carol", testChannel, testNick + ": pvm", testChannel},
+		{"private", "dave", testNick, "!pvm", "dave"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := bot.Privmsg(tt.nick, tt.target, tt.message); err != nil {
+				t.Fatal(err)
+			}
+			reply, err := bot.ExpectMessage(tt.replyTo, testTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(reply, "Tänään on") {
+				t.Errorf("unexpected reply %q", reply)
+			}
+		})
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	bot := newTestBot(t, nil)
+	defer bot.stop()
+	bot.joined(testChannel)
+
+	bot.say("alice", testChannel, "!nosuchcommand")
+	if err := bot.ExpectNoMessage(testChannel, time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGlobalListener(t *testing.T) {
+	bot := newTestBot(t, nil)
+	defer bot.stop()
+	bot.joined(testChannel)
+
+	bot.say("alice", testChannel, "pitäiskö lähteä kaljalle")
+	switch reply := bot.expect(testChannel); reply {
+	case "pitäis", "ei pitäis", "ehkä":
+	default:
+		t.Errorf("unexpected reply %q", reply)
+	}
+
+	bot.say("alice", testChannel, "ihan tavallinen viesti")
+	if err := bot.ExpectNoMessage(testChannel, time.Second); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScheduledJob(t *testing.T) {
+	bot := newTestBot(t, nil)
+	defer bot.stop()
+	bot.joined(testChannel)
+
+	if err := bot.ExpectNoMessage(testChannel, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// the date is told on every channel at midnight
+	bot.clock.Advance(time.Minute)
+	_, err := bot.Expect(testTimeout, func(e *girc.Event) bool {
+		return irctest.IsMessageTo(testChannel)(e) && strings.HasPrefix(e.Last(), "Tänään on")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduledBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofibot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bot := newTestBot(t, func(cfg *config.BotConfiguration) {
+		cfg.Database = config.DatabaseConfiguration{
+			BackupDir:  dir,
+			BackupSpec: "0 0 * * *",
+			BackupKeep: 1,
+		}
+	})
+	defer bot.stop()
+	bot.joined(testChannel)
+
+	bot.clock.Advance(time.Minute)
+	deadline := time.Now().Add(testTimeout)
+	for {
+		backups, err := database.Backups(bot.db.Path(), dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(backups) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backups after midnight: %v", backups)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
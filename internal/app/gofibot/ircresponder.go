@@ -0,0 +1,40 @@
+package gofibot
+
+import (
+	"github.com/lrstanley/girc"
+)
+
+// ircSender implements modules.Sender by queueing to the outgoing queue
+type ircSender struct {
+	queue    *outQueue
+	priority Priority
+}
+
+func newIRCSender(queue *outQueue, priority Priority) *ircSender {
+	return &ircSender{queue: queue, priority: priority}
+}
+
+// Message sends a PRIVMSG to target
+func (s *ircSender) Message(target, message string) {
+	s.queue.Push(s.priority, girc.PRIVMSG, target, message)
+}
+
+// Notice sends a NOTICE to target
+func (s *ircSender) Notice(target, message string) {
+	s.queue.Push(s.priority, girc.NOTICE, target, message)
+}
+
+// Action sends a CTCP ACTION (/me) to target
+func (s *ircSender) Action(target, message string) {
+	s.queue.Push(s.priority, girc.CTCP_ACTION, target, message)
+}
+
+// Topic sets the topic of channel
+func (s *ircSender) Topic(channel, topic string) {
+	s.queue.Push(s.priority, girc.TOPIC, channel, topic)
+}
+
+// Kick kicks nick from channel
+func (s *ircSender) Kick(channel, nick, reason string) {
+	s.queue.Push(s.priority, girc.KICK, channel, nick, reason)
+}
@@ -1,11 +1,16 @@
 package gofibot
 
 import (
+	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/huqa/gofibot/internal/pkg/config"
 	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/migrate"
 	"github.com/huqa/gofibot/internal/pkg/modules"
+	"github.com/huqa/gofibot/internal/pkg/storage"
 	"github.com/lrstanley/girc"
 	bolt "go.etcd.io/bbolt"
 )
@@ -13,52 +18,106 @@ import (
 type IRCServiceInterface interface {
 	Init() error
 	Stop() error
+	Run(ctx context.Context) error
 	Connect() error
+	State() ConnectionState
 	LoadModules() error
 	JoinChannels() error
 	RegisterModuleCallbacks()
+	Reload(cfg config.BotConfiguration) error
+	OnReload(reload func() error)
 }
 
 type IRCService struct {
 	log           logger.Logger
 	moduleService ModuleServiceInterface
+	configMu      sync.RWMutex
 	config        config.BotConfiguration
 	client        *girc.Client
+	dialer        girc.Dialer
+	auth          *authenticator
+	queue         *outQueue
+	responder     modules.Responder
 	db            *bolt.DB
 	callbacks     []string
 	location      *time.Location
+
+	stateMu   sync.Mutex
+	state     ConnectionState
+	connected bool
 }
 
-func NewIRCService(log logger.Logger, db *bolt.DB, cfg config.BotConfiguration) IRCServiceInterface {
+func NewIRCService(log logger.Logger, db *bolt.DB, cfg config.BotConfiguration) (IRCServiceInterface, error) {
 
 	config := girc.Config{
 		Nick:   cfg.Nick,
 		User:   cfg.Ident,
 		Name:   cfg.Realname,
 		Server: cfg.Server,
-		Port:   6667,
+		Port:   cfg.Port,
 		Out:    log,
+		// outgoing messages are rate limited by outQueue
+		AllowFlood: true,
 	}
 
-	log.Debug(config)
+	log.Debug(cfg)
+
+	sasl, err := newSASLMech(cfg)
+	if err != nil {
+		return nil, err
+	}
+	config.SASL = sasl
 
 	client := girc.New(config)
+	auth := newAuthenticator(log, cfg, sasl != nil)
+	auth.register(client)
+
+	var dialer girc.Dialer
+	if cfg.TLS {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if !cfg.TLSVerify {
+			log.Info("tls certificate verification is disabled")
+		}
+		dialer = &tlsDialer{config: tlsConfig}
+	}
 
-	loc, err := time.LoadLocation(cfg.Location)
+	loc := loadLocation(log, cfg.Location)
+
+	queue := newOutQueue(log, cfg.Flood, client)
+	responder := modules.NewResponder(newIRCSender(queue, PriorityNormal))
+	admin := modules.NewResponder(newIRCSender(queue, PriorityHigh))
+	moduleService, err := NewModuleService(log, cfg, loc, db, responder, admin)
 	if err != nil {
-		log.Error("can't load given timezone", err)
-		loc, _ = time.LoadLocation("UTC")
+		return nil, err
 	}
+	queue.Start()
 
 	return &IRCService{
 		config:        cfg,
 		client:        client,
+		dialer:        dialer,
+		auth:          auth,
+		queue:         queue,
+		responder:     responder,
 		callbacks:     make([]string, 0),
 		log:           log.Named("ircservice"),
-		moduleService: NewModuleService(log, cfg.Channels, cfg.Prefix, loc),
+		moduleService: moduleService,
 		db:            db,
 		location:      loc,
+	}, nil
+}
+
+// loadLocation loads the timezone called name, falling back to UTC
+func loadLocation(log logger.Logger, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Error("can't load given timezone", err)
+		loc, _ = time.LoadLocation("UTC")
 	}
+	return loc
 }
 
 func (is *IRCService) Init() error {
@@ -78,28 +137,29 @@ func (is *IRCService) Init() error {
 }
 
 func (is *IRCService) Stop() error {
-	is.client.Quit("quit")
 	is.moduleService.StopModules()
+	is.client.Quit("quit")
+	is.queue.Stop()
 	return nil
 }
 
 func (is *IRCService) Connect() error {
-	is.log.Info("connecting to server: ", is.config.Server)
+	is.log.Infof("connecting to server: %s:%d (tls: %v)", is.client.Config.Server, is.client.Config.Port, is.configuration().TLS)
+	if is.dialer != nil {
+		return is.client.DialerConnect(is.dialer)
+	}
 	return is.client.Connect()
 }
 
 func (is *IRCService) LoadModules() error {
 	is.log.Info("loading modules")
 
-	err := is.moduleService.RegisterModules(
-		//modules.NewEchoModule(is.log, is.client),
-		modules.NewWeatherModule(is.log, is.client),
-		modules.NewStatsModule(is.log, is.client, is.db, is.location),
-		modules.NewURLTitleModule(is.log, is.client),
-		modules.NewDateModule(is.log, is.client, is.location),
-		modules.NewGuessModule(is.log, is.client, is.db, is.location),
-		modules.NewShouldModule(is.log, is.client),
-	)
+	botmodules := botModules(is.log, is.responder, is.db, is.location)
+	_, err := migrateModules(is.log, is.db, botmodules, migrate.Options{})
+	if err != nil {
+		return fmt.Errorf("can't migrate module data: %v", err)
+	}
+	err = is.moduleService.RegisterModules(botmodules...)
 	if err != nil {
 		return err
 	}
@@ -107,25 +167,84 @@ func (is *IRCService) LoadModules() error {
 	return nil
 }
 
+// botModules constructs the modules of the bot, each module storing data
+// gets a namespace of its own
+func botModules(log logger.Logger, responder modules.Responder, db *bolt.DB, location *time.Location) []modules.ModuleInterface {
+	store := storage.NewBolt(db)
+	return []modules.ModuleInterface{
+		//modules.NewEchoModule(log, responder),
+		modules.NewWeatherModule(log, responder),
+		modules.NewStatsModule(log, responder, store.Namespace(moduleNamespace("stats")), location),
+		modules.NewURLTitleModule(log, responder),
+		modules.NewDateModule(log, responder, location),
+		modules.NewGuessModule(log, responder, store.Namespace(moduleNamespace("guess")), location),
+		modules.NewShouldModule(log, responder),
+	}
+}
+
 func (is *IRCService) JoinChannels() error {
-	is.log.Info("joining channels when connected: ", is.config.Channels)
+	is.log.Info("joining channels when connected: ", is.Channels())
 
 	is.client.Handlers.Add(girc.CONNECTED, func(c *girc.Client, e girc.Event) {
-		for _, ch := range is.Channels() {
-			is.log.Info("joining channel: ", ch)
-			c.Cmd.Join(ch)
-		}
+		is.setState(StateConnected)
+		// handlers block the event loop, wait for services elsewhere
+		go func() {
+			is.auth.authenticate(c)
+			for _, ch := range is.Channels() {
+				is.log.Info("joining channel: ", ch)
+				c.Cmd.Join(ch)
+			}
+		}()
 	})
 	return nil
 }
 
 func (is *IRCService) RegisterModuleCallbacks() {
-	cbID := is.client.Handlers.Add(girc.PRIVMSG, func(c *girc.Client, e girc.Event) {
-		go is.moduleService.PRIVMSGCallback(&e)
-	})
-	is.callbacks = append(is.callbacks, cbID)
+	for _, event := range is.moduleService.Events() {
+		cbID := is.client.Handlers.Add(event, func(c *girc.Client, e girc.Event) {
+			is.moduleService.Dispatch(withAccount(c, &e))
+		})
+		is.log.Info("registered callback for ", event)
+		is.callbacks = append(is.callbacks, cbID)
+	}
+	// commands can be addressed to the current nick of the bot
+	for _, event := range []string{girc.CONNECTED, girc.NICK} {
+		is.client.Handlers.Add(event, func(c *girc.Client, e girc.Event) {
+			is.moduleService.SetNick(c.GetNick())
+		})
+	}
+}
+
+// configuration returns a copy of the configuration, which Reload may
+// change while the bot runs
+func (is *IRCService) configuration() config.BotConfiguration {
+	is.configMu.RLock()
+	defer is.configMu.RUnlock()
+	return is.config
 }
 
 func (is *IRCService) Channels() []string {
+	is.configMu.RLock()
+	defer is.configMu.RUnlock()
 	return is.config.Channels
 }
+
+// withAccount tags e with the services account of its source when the
+// server did not send an account tag but girc tracks the account
+func withAccount(c *girc.Client, e *girc.Event) *girc.Event {
+	if e.Source == nil {
+		return e
+	}
+	if _, ok := e.Tags.Get("account"); ok {
+		return e
+	}
+	user := c.LookupUser(e.Source.Name)
+	if user == nil || user.Extras.Account == "" {
+		return e
+	}
+	if e.Tags == nil {
+		e.Tags = make(girc.Tags)
+	}
+	e.Tags.Set("account", user.Extras.Account)
+	return e
+}
@@ -0,0 +1,48 @@
+package gofibot
+
+import (
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/migrate"
+	"github.com/huqa/gofibot/internal/pkg/modules"
+	bolt "go.etcd.io/bbolt"
+)
+
+// moduleNamespaces are the namespaces of modules whose data predates
+// namespaces, other modules use their name
+var moduleNamespaces = map[string]string{
+	"stats": "Stats",
+	"guess": "Guess",
+}
+
+// moduleNamespace returns the namespace of the data of module
+func moduleNamespace(module string) string {
+	if ns, ok := moduleNamespaces[module]; ok {
+		return ns
+	}
+	return module
+}
+
+// MigrateModules runs the pending migrations of the modules of the bot
+// and returns them
+func MigrateModules(log logger.Logger, db *bolt.DB, opts migrate.Options) ([]migrate.Step, error) {
+	return migrateModules(log, db, botModules(log, nil, db, time.UTC), opts)
+}
+
+// migrateModules runs the pending migrations of botmodules
+func migrateModules(log logger.Logger, db *bolt.DB, botmodules []modules.ModuleInterface, opts migrate.Options) ([]migrate.Step, error) {
+	schemas := make([]migrate.Schema, 0)
+	for _, md := range botmodules {
+		migrating, ok := md.(modules.Migrating)
+		if !ok {
+			continue
+		}
+		schemas = append(schemas, migrate.Schema{
+			Name:       md.Name(),
+			Namespace:  moduleNamespace(md.Name()),
+			Migrations: migrating.Migrations(),
+		})
+	}
+	return migrate.Run(log.Named("migrate"), db, schemas, opts)
+}
@@ -0,0 +1,110 @@
+package gofibot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/migrate"
+	"github.com/huqa/gofibot/internal/pkg/modules"
+	"github.com/huqa/gofibot/internal/pkg/storage"
+	"github.com/huqa/gofibot/internal/pkg/utils"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+// schemaVersions returns the schema versions in the Meta bucket of db
+func schemaVersions(t *testing.T, db *bolt.DB) map[string]int {
+	t.Helper()
+	versions := make(map[string]int)
+	err := storage.NewBolt(db).Collection("Meta", storage.JSON).Iterate(func(name string, decode func(v interface{}) error) error {
+		var v struct{ Version int }
+		if err := decode(&v); err != nil {
+			return err
+		}
+		versions[name] = v.Version
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return versions
+}
+
+func TestMigrateModules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofibot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// data written before schema versions
+	store := storage.NewBolt(db)
+	stats := store.Namespace("Stats").Collection(testChannel, storage.JSON)
+	stats.Put("alice", modules.ChannelStats{Nick: "alice", Words: 3})
+	stats.Put("bob", json.RawMessage(`"invalid"`))
+	guess := store.Namespace("Guess")
+	guess.Collection("Stats", storage.JSON).Put("carol", modules.Guess{Guesses: 2, Rights: 1})
+	guess.Collection("Rolls", storage.JSON).Put(string(utils.Itob(42)), modules.Roll{Rolls: 5})
+
+	log := &logger.LogWrapper{SugaredLogger: zap.NewNop().Sugar()}
+	migrations := func(opts migrate.Options) []migrate.Step {
+		t.Helper()
+		steps, err := migrateModules(log, db, botModules(log, nil, db, time.UTC), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return steps
+	}
+
+	steps := migrations(migrate.Options{DryRun: true})
+	if len(steps) != 4 {
+		t.Errorf("dry run returned %d steps, want 4: %v", len(steps), steps)
+	}
+	if versions := schemaVersions(t, db); len(versions) != 0 {
+		t.Errorf("dry run saved schema versions %v", versions)
+	}
+	var cs modules.ChannelStats
+	if found, err := stats.Get("bob", &cs); !found {
+		t.Errorf("dry run deleted invalid stats: %v", err)
+	}
+
+	backup := filepath.Join(dir, "backup.db")
+	migrations(migrate.Options{BackupPath: backup})
+	want := map[string]int{"stats": 2, "guess": 2}
+	if versions := schemaVersions(t, db); !reflect.DeepEqual(versions, want) {
+		t.Errorf("schema versions = %v, want %v", versions, want)
+	}
+	if _, err := os.Stat(backup); err != nil {
+		t.Errorf("database was not backed up: %v", err)
+	}
+
+	if _, err := stats.Get("alice", &cs); err != nil || cs.Channel != testChannel {
+		t.Errorf("stats of alice = %+v, %v, want channel %s", cs, err, testChannel)
+	}
+	if found, _ := stats.Get("bob", &cs); found {
+		t.Error("invalid stats were not deleted")
+	}
+	var g modules.Guess
+	if _, err := guess.Collection("Stats", storage.JSON).Get("carol", &g); err != nil || g.Nick != "carol" {
+		t.Errorf("guesses of carol = %+v, %v", g, err)
+	}
+	var r modules.Roll
+	if _, err := guess.Collection("Rolls", storage.JSON).Get(string(utils.Itob(42)), &r); err != nil || r.Value != 42 || r.Rolls != 5 {
+		t.Errorf("roll 42 = %+v, %v", r, err)
+	}
+
+	if steps := migrations(migrate.Options{}); len(steps) != 0 {
+		t.Errorf("migrated data has pending steps %v", steps)
+	}
+}
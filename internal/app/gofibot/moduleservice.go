@@ -1,56 +1,189 @@
 package gofibot
 
 import (
+	"context"
+	"fmt"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/huqa/gofibot/internal/pkg/acl"
+	"github.com/huqa/gofibot/internal/pkg/cmdline"
+	"github.com/huqa/gofibot/internal/pkg/config"
 	"github.com/huqa/gofibot/internal/pkg/logger"
 	"github.com/huqa/gofibot/internal/pkg/modules"
+	"github.com/huqa/gofibot/internal/pkg/scheduler"
 	"github.com/lrstanley/girc"
+	bolt "go.etcd.io/bbolt"
 )
 
 // ModuleServiceInterface defines an interface for ModuleService
 type ModuleServiceInterface interface {
 	RegisterModules(botmodules ...modules.ModuleInterface) error
 	Command(string) modules.ModuleInterface
+	SetNick(nick string)
+	SetClock(clock scheduler.Clock)
 	PRIVMSGCallback(e *girc.Event)
+	EventCallback(e *girc.Event)
+	Dispatch(e *girc.Event)
+	Events() []string
 	StopModules() error
+	Reload(cfg config.BotConfiguration) error
+	OnReload(reload func() error)
 }
 
 // ModuleService handles gofibots command based modules
 type ModuleService struct {
 	log            logger.Logger
-	channels       []string
+	db             *bolt.DB
 	commands       map[string]modules.ModuleInterface
 	globalCommands []modules.ModuleInterface
 	modules        []modules.ModuleInterface
 	callbacks      []int
-	tickers        []*time.Ticker
-	timers         []*time.Timer
-	Prefix         string
+	scheduler      *scheduler.Scheduler
+	clock          scheduler.Clock
+	aliases        *aliases
+	nick           atomic.Value
 	location       *time.Location
+	responder      modules.Responder
+	admin          modules.Responder
+	acl            *acl.ACL
+	ignore         *acl.IgnoreList
+	switches       *moduleSwitches
+	cooldowns      *cooldowns
+	breaker        *breaker
+	workers        *workerPool
+	reload         func() error
+	core           *coreModule
+
+	// ctx is the parent of the contexts of module runs, cancel tells
+	// runs to stop on shutdown
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// locks keep modules from being reinitialized while they run
+	locksMu sync.Mutex
+	locks   map[string]*sync.RWMutex
+
+	// mu guards the settings below, they are replaced on reload
+	mu           sync.RWMutex
+	channels     []string
+	schedules    map[string]config.ScheduleConfiguration
+	Prefix       string
+	prefixes     map[string][]string
+	moduleRoles  map[string]acl.Role
+	commandRoles map[string]acl.Role
+	timeout      time.Duration
+	notify       []string
+	database     config.DatabaseConfiguration
 }
 
-// NewModuleService constructs new ModuleService
-func NewModuleService(log logger.Logger, channels []string, prefix string, location *time.Location) ModuleServiceInterface {
-	return &ModuleService{
+// NewModuleService constructs new ModuleService, admin output is sent
+// through the admin responder
+func NewModuleService(log logger.Logger, cfg config.BotConfiguration, location *time.Location, db *bolt.DB, responder, admin modules.Responder) (ModuleServiceInterface, error) {
+	accessList, err := acl.New(db, cfg.Owners)
+	if err != nil {
+		return nil, fmt.Errorf("can't load acl: %v", err)
+	}
+	ignoreList, err := acl.NewIgnoreList(db)
+	if err != nil {
+		return nil, fmt.Errorf("can't load ignore list: %v", err)
+	}
+	switches, err := newModuleSwitches(db, cfg.ChannelModules)
+	if err != nil {
+		return nil, fmt.Errorf("can't load module switches: %v", err)
+	}
+	commandAliases, err := newAliases(db)
+	if err != nil {
+		return nil, fmt.Errorf("can't load aliases: %v", err)
+	}
+	lastRuns, err := scheduler.NewBoltStore(db)
+	if err != nil {
+		return nil, fmt.Errorf("can't load schedules: %v", err)
+	}
+	moduleRoles, err := parseRoles(cfg.Permissions.Modules)
+	if err != nil {
+		return nil, err
+	}
+	commandRoles, err := parseRoles(cfg.Permissions.Commands)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &ModuleService{
 		log:            log.Named("moduleservice"),
-		channels:       channels,
+		db:             db,
+		channels:       cfg.Channels,
 		globalCommands: make([]modules.ModuleInterface, 0),
 		commands:       make(map[string]modules.ModuleInterface, 0),
-		tickers:        make([]*time.Ticker, 0),
-		timers:         make([]*time.Timer, 0),
-		Prefix:         prefix,
+		scheduler:      scheduler.New(log, location, scheduler.RealClock(), lastRuns),
+		clock:          scheduler.RealClock(),
+		schedules:      cfg.Schedules,
+		Prefix:         cfg.Prefix,
+		prefixes:       channelPrefixes(cfg.Prefixes),
+		aliases:        commandAliases,
 		location:       location,
+		responder:      responder,
+		acl:            accessList,
+		ignore:         ignoreList,
+		switches:       switches,
+		moduleRoles:    moduleRoles,
+		commandRoles:   commandRoles,
+		cooldowns:      newCooldowns(cfg.RateLimit),
+		admin:          admin,
+		breaker:        newBreaker(cfg.Execution),
+		timeout:        time.Duration(cfg.Execution.Timeout) * time.Second,
+		notify:         cfg.Execution.Notify,
+		database:       cfg.Database,
+		workers:        newWorkerPool(log, cfg.Execution.Workers, cfg.Execution.QueueSize),
+		locks:          make(map[string]*sync.RWMutex),
+		ctx:            ctx,
+		cancel:         cancel,
 	}
+	m.nick.Store(cfg.Nick)
+	m.core = newCoreModule(log, m, admin)
+	return m, nil
 }
 
-// StopModules stops all registered modules
-func (m *ModuleService) StopModules() error {
-	m.log.Info("stopping tickers")
-	for _, ticker := range m.tickers {
-		ticker.Stop()
+// SetClock replaces the clock of scheduled jobs and cooldowns, it must
+// be called before RegisterModules
+func (m *ModuleService) SetClock(clock scheduler.Clock) {
+	m.clock = clock
+	m.scheduler.SetClock(clock)
+}
+
+// channelPrefixes keys prefixes by normalized channel names
+func channelPrefixes(prefixes map[string][]string) map[string][]string {
+	byChannel := make(map[string][]string, len(prefixes))
+	for channel, p := range prefixes {
+		byChannel[girc.ToRFC1459(channel)] = p
 	}
+	return byChannel
+}
+
+// parseRoles parses a map of role names
+func parseRoles(names map[string]string) (map[string]acl.Role, error) {
+	roles := make(map[string]acl.Role, len(names))
+	for key, name := range names {
+		role, err := acl.ParseRole(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid permission for %s: %v", key, err)
+		}
+		roles[key] = role
+	}
+	return roles, nil
+}
+
+// StopModules waits for queued events to be handled, cancels the runs
+// still going and stops all registered modules
+func (m *ModuleService) StopModules() error {
+	m.log.Info("draining event queue")
+	m.workers.Stop(shutdownTimeout)
+	m.cancel()
+	m.log.Info("stopping scheduler")
+	m.scheduler.Stop()
 	m.log.Info("stopping modules")
 	for _, module := range m.modules {
 		err := module.Stop()
@@ -62,9 +195,11 @@ func (m *ModuleService) StopModules() error {
 }
 
 // RegisterModules registers modules to ModuleService
-// First registers a module and then calls its Init method
+// First registers a module and then calls its Init method.
+// The core module with built-in commands is always registered first.
 func (m *ModuleService) RegisterModules(botmodules ...modules.ModuleInterface) error {
-	for i, md := range botmodules {
+	botmodules = append([]modules.ModuleInterface{m.core}, botmodules...)
+	for _, md := range botmodules {
 		if md.Global() {
 			m.globalCommands = append(m.globalCommands, md)
 			m.log.Infof("registered public command")
@@ -77,73 +212,498 @@ func (m *ModuleService) RegisterModules(botmodules ...modules.ModuleInterface) e
 		if err != nil {
 			return err
 		}
-		hasSchedule, nextRunTime, duration := md.Schedule()
-		if hasSchedule {
-			now := time.Now().In(m.location)
-			nextRunDuration := nextRunTime.Sub(now)
-			moduleToCall := botmodules[i]
-			timer := time.AfterFunc(nextRunDuration, func() {
-				m.schedulePRIVMSG(moduleToCall, duration)
-			})
-			m.timers = append(m.timers, timer)
+		if scheduled, ok := md.(modules.Scheduled); ok {
+			for _, job := range scheduled.Jobs() {
+				if err := m.addJob(md, job); err != nil {
+					return err
+				}
+			}
 		}
 	}
+	if err := m.scheduleBackup(m.database); err != nil {
+		return err
+	}
 	m.modules = botmodules
+	m.workers.Start()
+	m.scheduler.Start()
 	return nil
 }
 
-// Command checks if str is found from a map and returns that commands module
+// addJob schedules job of md, the configuration may override its
+// schedule and channels
+func (m *ModuleService) addJob(md modules.ModuleInterface, job modules.Job) error {
+	name := md.Name() + "/" + job.Name
+	m.mu.RLock()
+	cfg, ok := m.schedules[name]
+	m.mu.RUnlock()
+	if ok {
+		if cfg.Spec != "" {
+			job.Spec = cfg.Spec
+		}
+		if cfg.Channels != nil {
+			job.Channels = cfg.Channels
+		}
+	}
+	m.log.Infof("scheduled %s at %s on %v", name, job.Spec, job.Channels)
+	return m.scheduler.Add(name, job.Spec, job.CatchUp, func(time.Time) {
+		m.runJob(md, job)
+	})
+}
+
+// runJob runs job of md on each of its channels where md is enabled and
+// waits for the runs. Runs are queued with the events of their channel
+// so they never run alongside commands of the same channel.
+func (m *ModuleService) runJob(md modules.ModuleInterface, job modules.Job) {
+	scheduled := md.(modules.Scheduled)
+	m.mu.RLock()
+	botChannels := m.channels
+	m.mu.RUnlock()
+	channels := make([]string, 0, len(job.Channels))
+	for _, channel := range job.Channels {
+		if channel == modules.AllChannels {
+			channels = append(channels, botChannels...)
+			continue
+		}
+		channels = append(channels, channel)
+	}
+	if len(job.Channels) == 0 {
+		// jobs without channels run once
+		channels = append(channels, "")
+	}
+	var wg sync.WaitGroup
+	for _, channel := range channels {
+		if !m.enabled(channel, md) {
+			continue
+		}
+		ch := channel
+		wg.Add(1)
+		submitted := m.workers.Submit(girc.ToRFC1459(ch), func() {
+			defer wg.Done()
+			m.call(md, job.Name, ch, func(ctx context.Context) error {
+				return scheduled.RunJob(ctx, job.Name, ch)
+			})
+		})
+		if !submitted {
+			m.log.Errorf("can't run %s/%s on %s, the event queue is full or stopped", md.Name(), job.Name, ch)
+			wg.Done()
+		}
+	}
+	wg.Wait()
+}
+
+// Dispatch queues e to be handled after earlier events of the same
+// channel, or of the same user outside channels
+func (m *ModuleService) Dispatch(e *girc.Event) {
+	key := dispatchKey(e)
+	callback := m.EventCallback
+	if e.Command == girc.PRIVMSG {
+		callback = m.PRIVMSGCallback
+	}
+	m.workers.Submit(key, func() {
+		callback(e)
+	})
+}
+
+// dispatchKey returns the worker key of e, the channel of messages, joins,
+// parts, kicks and topics and otherwise the nick of the source
+func dispatchKey(e *girc.Event) string {
+	if ev := modules.NewEvent(e); ev != nil && ev.Channel != "" {
+		return girc.ToRFC1459(ev.Channel)
+	}
+	if e.Source != nil {
+		return girc.ToRFC1459(e.Source.Name)
+	}
+	return ""
+}
+
+// Command returns the module of command str, aliases are resolved to
+// the module of the command they alias
 func (m *ModuleService) Command(str string) modules.ModuleInterface {
-	if md, ok := m.commands[str]; ok {
+	command, _ := m.resolve(str, nil)
+	if md, ok := m.commands[command]; ok {
 		return md
 	}
 	return nil
 }
 
-// PRIVMSGCallback calls a modules Run function if event or command matches
+// resolve returns the command and arguments to run for command with args.
+// Commands of modules take precedence over aliases, and aliases a module
+// declares in its help are replaced by the command they stand for so
+// permissions and cooldowns of the command apply to them.
+func (m *ModuleService) resolve(command string, args []string) (string, []string) {
+	if _, ok := m.commands[command]; !ok {
+		if target, aliasArgs, ok := m.aliases.Resolve(command); ok {
+			command, args = target, append(aliasArgs, args...)
+		}
+	}
+	return m.canonical(command), args
+}
+
+// canonical returns the command a module alias of command stands for
+func (m *ModuleService) canonical(command string) string {
+	md, ok := m.commands[command]
+	if !ok {
+		return command
+	}
+	if h, ok := modules.FindHelp(md, command); ok {
+		if _, ok := m.commands[h.Command]; ok {
+			return h.Command
+		}
+	}
+	return command
+}
+
+// SetNick sets the nick the bot is addressed with
+func (m *ModuleService) SetNick(nick string) {
+	m.nick.Store(nick)
+}
+
+// prefixesOf returns the command prefixes of channel
+func (m *ModuleService) prefixesOf(channel string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if prefixes, ok := m.prefixes[girc.ToRFC1459(channel)]; ok && channel != "" {
+		return prefixes
+	}
+	return []string{m.Prefix}
+}
+
+// prefix returns the prefix shown to users on channel
+func (m *ModuleService) prefix(channel string) string {
+	prefixes := m.prefixesOf(channel)
+	if len(prefixes) == 0 {
+		return ""
+	}
+	return prefixes[0]
+}
+
+// stripPrefix returns message without its command prefix, it returns
+// false if message does not start with a prefix of channel
+func (m *ModuleService) stripPrefix(channel, message string) (string, bool) {
+	for _, prefix := range m.prefixesOf(channel) {
+		if prefix != "" && strings.HasPrefix(message, prefix) {
+			return strings.TrimPrefix(message, prefix), true
+		}
+	}
+	return "", false
+}
+
+// stripNick returns message without the nick of the bot when the bot
+// is addressed as in "gofibot: w tampere" or "gofibot, w tampere"
+func (m *ModuleService) stripNick(message string) (string, bool) {
+	nick, _ := m.nick.Load().(string)
+	if nick == "" || len(message) <= len(nick) {
+		return "", false
+	}
+	if girc.ToRFC1459(message[:len(nick)]) != girc.ToRFC1459(nick) {
+		return "", false
+	}
+	rest := message[len(nick):]
+	if !strings.HasPrefix(rest, ":") && !strings.HasPrefix(rest, ",") {
+		return "", false
+	}
+	return strings.TrimLeft(rest[1:], " "), true
+}
+
+// PRIVMSGCallback calls a modules Handle function if event or command matches.
+// Messages addressed to the bot that aren't commands are passed to
+// global listeners like any other message.
 func (m *ModuleService) PRIVMSGCallback(e *girc.Event) {
+	ev := modules.NewEvent(e)
+	if ev == nil {
+		return
+	}
+	if ev.Type != modules.EventPrivmsg {
+		m.dispatchEvent(ev)
+		return
+	}
 
-	channel := e.Params[0]
-	params := strings.Split(e.Params[1], " ")
-	if !strings.HasPrefix(e.Params[1], m.Prefix) {
-		for _, pcmd := range m.globalCommands {
-			//m.log.Debug(e.Source.Name, channel, message, e.Params[1:])
-			err := pcmd.Run(channel, e.Source.String(), e.Source.Name, "", params)
-			if err != nil {
-				m.log.Error("module run error: ", err)
-			}
+	role := m.role(ev)
+	if role == acl.RoleIgnored {
+		return
+	}
+
+	line, prefixed := m.stripPrefix(ev.Channel, ev.Message)
+	addressed := false
+	if !prefixed {
+		line, addressed = m.stripNick(ev.Message)
+	}
+	var msm modules.ModuleInterface
+	var command string
+	var args []string
+	tokens, tokenErr := cmdline.Tokenize(line)
+	if tokenErr != nil {
+		// still find the command to tell the user what went wrong
+		tokens = strings.Fields(line)
+	}
+	if (prefixed || addressed) && len(tokens) > 0 {
+		command, args = m.resolve(tokens[0], tokens[1:])
+		msm = m.Command(command)
+	}
+	if msm == nil {
+		if !prefixed {
+			m.runGlobals(ev, role)
 		}
 		return
 	}
 
-	withoutPrefix := strings.Replace(e.Params[1], m.Prefix, "", 1)
-	command := strings.Split(withoutPrefix, " ")[0]
-	msm := m.Command(command)
-	if msm != nil {
-		if msm.Event() != "PRIVMSG" {
-			return
+	if !m.canRun(ev, role, command, msm) {
+		m.log.Debugf("%s with role %s can't run %s here", ev.Source, role, command)
+		return
+	}
+	if !m.allowCommand(ev, command, msm) {
+		return
+	}
+	if tokenErr != nil {
+		m.responder.Reply(ev, fmt.Sprintf("%s%s - %v", m.prefix(ev.Channel), command, tokenErr))
+		return
+	}
+	args, flags, err := m.parseArgs(ev.Channel, command, msm, args)
+	if err != nil {
+		m.responder.Reply(ev, fmt.Sprintf("%s%s - %v", m.prefix(ev.Channel), command, err))
+		return
+	}
+	m.call(msm, command, ev.Channel, func(ctx context.Context) error {
+		c := modules.NewContext(ctx, ev, command, args, m.responder)
+		c.Flags = flags
+		return msm.Handle(c)
+	})
+}
+
+// parseArgs checks args against the argument spec of command if md
+// declares one and separates its options
+func (m *ModuleService) parseArgs(channel, command string, md modules.ModuleInterface, args []string) ([]string, map[string]string, error) {
+	h, ok := modules.FindHelp(md, command)
+	if !ok || h.Args == nil {
+		return args, make(map[string]string), nil
+	}
+	return h.Args.Parse(m.prefix(channel)+command, args)
+}
+
+// runGlobals passes a message that isn't a command to global listeners
+func (m *ModuleService) runGlobals(ev *modules.Event, role acl.Role) {
+	params := strings.Fields(ev.Message)
+	for _, pcmd := range m.globalCommands {
+		if !pcmd.Contexts().Accepts(ev.Private) || !m.enabled(ev.Channel, pcmd) || m.ignored(ev, role, pcmd) {
+			continue
 		}
-		err := msm.Run(channel, e.Source.String(), e.Source.Name, command, params[1:])
+		md := pcmd
+		m.call(md, "", ev.Channel, func(ctx context.Context) error {
+			return md.Handle(modules.NewContext(ctx, ev, "", params, m.responder))
+		})
+	}
+}
+
+// canRun returns true if the source of ev with role may run command of md
+// where ev came from. Cooldowns are not checked.
+func (m *ModuleService) canRun(ev *modules.Event, role acl.Role, command string, md modules.ModuleInterface) bool {
+	if !modules.Subscribes(md, modules.EventPrivmsg) || !md.Contexts().Accepts(ev.Private) {
+		return false
+	}
+	if !m.enabled(ev.Channel, md) || m.ignored(ev, role, md) {
+		return false
+	}
+	return role >= m.minRole(command, md)
+}
+
+// allowCommand checks command cooldowns and the channel command limit
+func (m *ModuleService) allowCommand(ev *modules.Event, command string, md modules.ModuleInterface) bool {
+	duration := m.cooldowns.duration(command, md.Cooldown())
+	ok, wait, warn := m.cooldowns.allow(ev.Source.String(), ev.Channel, command, duration, m.clock.Now())
+	if ok {
+		return true
+	}
+	m.log.Debugf("rate limited %s from %s for %s", command, ev.Source, wait)
+	if warn {
+		m.responder.Notice(ev.Source.Name, fmt.Sprintf("slow down, %s%s is available again in %s", m.prefix(ev.Channel), command, wait.Round(time.Second)))
+	}
+	return false
+}
+
+// roleRequirer is implemented by modules with commands that need a
+// higher role than acl.RoleUser by default
+type roleRequirer interface {
+	MinRole(command string) acl.Role
+}
+
+// role returns the acl role of the source of ev
+func (m *ModuleService) role(ev *modules.Event) acl.Role {
+	if ev.Source == nil {
+		return acl.RoleUser
+	}
+	return m.acl.Role(ev.Source.String(), ev.Account)
+}
+
+// enabled returns true if md runs on channel, the core module always runs
+func (m *ModuleService) enabled(channel string, md modules.ModuleInterface) bool {
+	if md.Name() == coreModuleName {
+		return true
+	}
+	if m.breaker.Open(md.Name(), time.Now()) {
+		return false
+	}
+	return m.switches.Enabled(channel, md.Name())
+}
+
+// call runs fn for command of md on channel with panic recovery and the
+// configured timeout. A run that times out is reported as a failure when
+// the timeout passes, but call still waits for it to return so the next
+// event of the same worker never runs alongside it. Modules should stop
+// when the context of fn is done, which also happens on shutdown.
+// Failures count towards the circuit breaker of md.
+func (m *ModuleService) call(md modules.ModuleInterface, command, channel string, fn func(ctx context.Context) error) {
+	lock := m.moduleLock(md)
+	lock.RLock()
+	defer lock.RUnlock()
+	log := m.log.With("module", md.Name(), "command", command, "channel", channel)
+	m.mu.RLock()
+	timeout := m.timeout
+	m.mu.RUnlock()
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(m.ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(m.ctx)
+	}
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.With("stack", string(debug.Stack())).Errorf("module panic: %v", r)
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
 		if err != nil {
-			m.log.Error("module run error: ", err)
+			m.failure(log, md, err)
+		}
+	case <-ctx.Done():
+		if m.ctx.Err() != nil {
+			log.Info("run cancelled by shutdown")
+		} else {
+			m.failure(log, md, fmt.Errorf("timed out after %s", timeout))
+		}
+		start := time.Now()
+		if err := <-done; err != nil {
+			log.Errorf("module run error after timing out: %v", err)
+		}
+		log.Infof("abandoned run finished %s later", time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// moduleLock returns the lock of md. Runs of md hold it for reading and
+// reinitializing md holds it for writing.
+func (m *ModuleService) moduleLock(md modules.ModuleInterface) *sync.RWMutex {
+	m.locksMu.Lock()
+	defer m.locksMu.Unlock()
+	lock, ok := m.locks[md.Name()]
+	if !ok {
+		lock = &sync.RWMutex{}
+		m.locks[md.Name()] = lock
+	}
+	return lock
+}
+
+// failure logs err of md and counts it towards the circuit breaker
+func (m *ModuleService) failure(log logger.Logger, md modules.ModuleInterface, err error) {
+	log.Errorf("module run error: %v", err)
+	if md.Name() == coreModuleName || !m.breaker.Failure(md.Name(), time.Now()) {
+		return
+	}
+	m.mu.RLock()
+	notify := m.notify
+	m.mu.RUnlock()
+	cooldown := m.breaker.Cooldown()
+	log.Errorf("module disabled for %s after repeated failures", cooldown)
+	for _, target := range notify {
+		m.admin.Notice(target, fmt.Sprintf("module %s disabled for %s after repeated failures, last error: %v", md.Name(), cooldown, err))
+	}
+}
+
+// Module returns the registered module called name
+func (m *ModuleService) Module(name string) modules.ModuleInterface {
+	for _, md := range m.modules {
+		if strings.EqualFold(md.Name(), name) {
+			return md
 		}
 	}
+	return nil
+}
+
+// ignored returns true if md should not hear from the source of ev.
+// Entries only apply to roles lower than the role of whoever added them,
+// so owners can't be ignored and admins can't ignore each other.
+func (m *ModuleService) ignored(ev *modules.Event, role acl.Role, md modules.ModuleInterface) bool {
+	if ev.Source == nil || role == acl.RoleOwner {
+		return false
+	}
+	return m.ignore.Ignored(ev.Source.String(), ev.Account, role, md.Name())
+}
+
+// minRole returns the lowest role allowed to run command of md
+func (m *ModuleService) minRole(command string, md modules.ModuleInterface) acl.Role {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if role, ok := m.commandRoles[command]; ok {
+		return role
+	}
+	if role, ok := m.moduleRoles[md.Name()]; ok {
+		return role
+	}
+	if rr, ok := md.(roleRequirer); ok {
+		return rr.MinRole(command)
+	}
+	return acl.RoleUser
 }
 
-func (m *ModuleService) schedulePRIVMSG(md modules.ModuleInterface, duration time.Duration) {
-	ticker := time.NewTicker(duration)
-	m.tickers = append(m.tickers, ticker)
-	command := "schedule"
-	if len(md.Commands()) > 0 {
-		command = md.Commands()[0]
+// EventCallback passes non-command events to modules subscribed to them
+func (m *ModuleService) EventCallback(e *girc.Event) {
+	ev := modules.NewEvent(e)
+	if ev == nil {
+		return
 	}
-	for ; true; <-ticker.C {
-		for _, channel := range m.channels {
-			err := md.Run(channel, "SYSTEM", "SYSTEM", command, make([]string, 0))
-			if err != nil {
-				m.log.Error("error running scheduled module ", err)
+	m.dispatchEvent(ev)
+}
+
+func (m *ModuleService) dispatchEvent(ev *modules.Event) {
+	role := m.role(ev)
+	if role == acl.RoleIgnored {
+		return
+	}
+	for _, md := range m.modules {
+		listener, ok := md.(modules.EventListener)
+		if !ok || !modules.Subscribes(md, ev.Type) || !md.Contexts().Accepts(ev.Private) {
+			continue
+		}
+		if !m.enabled(ev.Channel, md) || m.ignored(ev, role, md) {
+			continue
+		}
+		m.call(md, ev.Type, ev.Channel, func(ctx context.Context) error {
+			return listener.OnEvent(ctx, ev)
+		})
+	}
+}
+
+// Events returns the girc event commands modules are subscribed to
+func (m *ModuleService) Events() []string {
+	seen := make(map[string]bool)
+	events := make([]string, 0)
+	for _, md := range m.modules {
+		for _, ev := range md.Events() {
+			cmd := modules.IRCCommand(ev)
+			if seen[cmd] {
+				continue
 			}
-			time.Sleep(5 * time.Second)
+			seen[cmd] = true
+			events = append(events, cmd)
 		}
 	}
+	return events
 }
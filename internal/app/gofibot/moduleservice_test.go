@@ -0,0 +1,598 @@
+package gofibot
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/acl"
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/modules"
+	"github.com/huqa/gofibot/internal/pkg/scheduler"
+	"github.com/lrstanley/girc"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+// testModule is a module calling the given functions
+type testModule struct {
+	name     string
+	commands []string
+	events   []string
+	help     []modules.CommandHelp
+	cooldown time.Duration
+	contexts modules.MessageContext
+	handle   func(c *modules.Context) error
+	onEvent  func(ctx context.Context, e *modules.Event) error
+	init     func() error
+	stop     func() error
+}
+
+func (m *testModule) Name() string                { return m.name }
+func (m *testModule) Events() []string            { return m.events }
+func (m *testModule) Commands() []string          { return m.commands }
+func (m *testModule) Global() bool                { return false }
+func (m *testModule) Cooldown() time.Duration     { return m.cooldown }
+func (m *testModule) Description() string         { return m.name }
+func (m *testModule) Help() []modules.CommandHelp { return m.help }
+
+func (m *testModule) Contexts() modules.MessageContext {
+	if m.contexts == 0 {
+		return modules.ContextAll
+	}
+	return m.contexts
+}
+
+func (m *testModule) Init() error {
+	if m.init == nil {
+		return nil
+	}
+	return m.init()
+}
+
+func (m *testModule) Stop() error {
+	if m.stop == nil {
+		return nil
+	}
+	return m.stop()
+}
+
+func (m *testModule) Handle(c *modules.Context) error {
+	if m.handle == nil {
+		return nil
+	}
+	return m.handle(c)
+}
+
+func (m *testModule) OnEvent(ctx context.Context, e *modules.Event) error {
+	if m.onEvent == nil {
+		return nil
+	}
+	return m.onEvent(ctx, e)
+}
+
+// testSender records what is sent
+type testSender struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (s *testSender) add(fields ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, strings.Join(fields, " "))
+}
+
+func (s *testSender) Message(target, message string)    { s.add("PRIVMSG", target, message) }
+func (s *testSender) Notice(target, message string)     { s.add("NOTICE", target, message) }
+func (s *testSender) Action(target, message string)     { s.add("ACTION", target, message) }
+func (s *testSender) Topic(channel, topic string)       { s.add("TOPIC", channel, topic) }
+func (s *testSender) Kick(channel, nick, reason string) { s.add("KICK", channel, nick, reason) }
+
+func (s *testSender) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = nil
+}
+
+func (s *testSender) Lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.lines...)
+}
+
+// newTestModuleService constructs a ModuleService on a temporary database
+// sending to a testSender, stop cleans up after it
+func newTestModuleService(t *testing.T) (m *ModuleService, sender *testSender, stop func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gofibot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.BotConfiguration{
+		Nick:     testNick,
+		Channels: []string{testChannel},
+		Prefix:   "!",
+		Execution: config.ExecutionConfiguration{
+			Timeout:         1,
+			BreakerFailures: 2,
+			BreakerWindow:   60,
+			BreakerCooldown: 60,
+			Notify:          []string{"admin"},
+			Workers:         4,
+			QueueSize:       100,
+		},
+	}
+	log := &logger.LogWrapper{SugaredLogger: zap.NewNop().Sugar()}
+	sender = &testSender{}
+	responder := modules.NewResponder(sender)
+	service, err := NewModuleService(log, cfg, time.UTC, db, responder, responder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = service.(*ModuleService)
+	return m, sender, func() {
+		m.StopModules()
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// privmsg handles a message of hostmask to target right away
+func privmsg(m *ModuleService, hostmask, target, message string) {
+	m.PRIVMSGCallback(girc.ParseEvent(fmt.Sprintf(":%s PRIVMSG %s :%s", hostmask, target, message)))
+}
+
+func TestCallTimeout(t *testing.T) {
+	m, sender, stop := newTestModuleService(t)
+	defer stop()
+	m.timeout = 50 * time.Millisecond
+	md := &testModule{name: "slow"}
+
+	// the timed out run is waited for
+	release := make(chan struct{})
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		m.call(md, "slow", testChannel, func(ctx context.Context) error {
+			<-release
+			return nil
+		})
+	}()
+	select {
+	case <-returned:
+		t.Fatal("call returned while the timed out run was still running")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if !m.enabled(testChannel, md) {
+		t.Error("disabled after one failure")
+	}
+	close(release)
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("call did not return after the run finished")
+	}
+
+	// the context tells modules to stop
+	m.call(md, "slow", testChannel, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if m.enabled(testChannel, md) {
+		t.Error("still enabled after two timeouts")
+	}
+	want := "NOTICE admin module slow disabled for 1m0s after repeated failures, last error: timed out after 50ms"
+	if lines := sender.Lines(); len(lines) != 1 || lines[0] != want {
+		t.Errorf("sent %q, want %q", lines, want)
+	}
+}
+
+func TestCallFailures(t *testing.T) {
+	m, sender, stop := newTestModuleService(t)
+	defer stop()
+	md := &testModule{name: "broken"}
+
+	m.call(md, "broken", testChannel, func(ctx context.Context) error {
+		panic("oops")
+	})
+	if !m.enabled(testChannel, md) {
+		t.Error("disabled after one failure")
+	}
+	m.call(md, "broken", testChannel, func(ctx context.Context) error {
+		return nil
+	})
+	m.call(md, "broken", testChannel, func(ctx context.Context) error {
+		return os.ErrNotExist
+	})
+	if m.enabled(testChannel, md) {
+		t.Error("still enabled after two failures")
+	}
+	if lines := sender.Lines(); len(lines) != 1 || !strings.HasSuffix(lines[0], "last error: "+os.ErrNotExist.Error()) {
+		t.Errorf("sent %q", lines)
+	}
+
+	// the core module is never disabled
+	for i := 0; i < 3; i++ {
+		m.call(m.core, "help", testChannel, func(ctx context.Context) error {
+			return os.ErrNotExist
+		})
+	}
+	if !m.enabled(testChannel, m.core) {
+		t.Error("disabled the core module")
+	}
+}
+
+func TestDispatchChannelOrder(t *testing.T) {
+	m, _, stop := newTestModuleService(t)
+	defer stop()
+
+	var mu sync.Mutex
+	handled := make([]string, 0)
+	record := func(entry string) {
+		// slow handlers would let events of other workers overtake
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, entry)
+	}
+	md := &testModule{
+		name:     "recorder",
+		commands: []string{"rec"},
+		events:   []string{modules.EventPrivmsg, modules.EventJoin, modules.EventPart, modules.EventTopic, modules.EventKick},
+		handle: func(c *modules.Context) error {
+			record("PRIVMSG " + c.Source.Name)
+			return nil
+		},
+		onEvent: func(ctx context.Context, e *modules.Event) error {
+			record(e.Type + " " + e.Source.Name)
+			return nil
+		},
+	}
+	if err := m.RegisterModules(md); err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]string, 0)
+	for i := 0; i < 20; i++ {
+		nick := fmt.Sprintf("nick%d", i)
+		lines := []string{
+			":%s!u@h JOIN " + testChannel,
+			":%s!u@h PRIVMSG " + testChannel + " :!rec",
+			":%s!u@h TOPIC " + testChannel + " :topic",
+			":%s!u@h KICK " + testChannel + " someone :bye",
+			":%s!u@h PART " + testChannel + " :bye",
+		}
+		for _, line := range lines {
+			e := girc.ParseEvent(fmt.Sprintf(line, nick))
+			m.Dispatch(e)
+			want = append(want, e.Command+" "+nick)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := len(handled)
+		mu.Unlock()
+		if n == len(want) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled %q, want %q", handled, want)
+	}
+}
+
+func TestDispatchKey(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{":nick!u@h PRIVMSG #Chan :hello", "#chan"},
+		{":nick!u@h NOTICE #chan :hello", "#chan"},
+		{":nick!u@h JOIN #Chan", "#chan"},
+		{":nick!u@h JOIN :#chan", "#chan"},
+		{":nick!u@h PART #chan :bye", "#chan"},
+		{":op!u@h KICK #chan nick :bye", "#chan"},
+		{":nick!u@h TOPIC #chan :topic", "#chan"},
+		{":Nick!u@h PRIVMSG gofibot :hello", "nick"},
+		{":Nick!u@h QUIT :bye", "nick"},
+		{":Nick!u@h NICK other", "nick"},
+	}
+	for _, tt := range tests {
+		if got := dispatchKey(girc.ParseEvent(tt.line)); got != tt.want {
+			t.Errorf("dispatchKey(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestReinitWaitsForRuns(t *testing.T) {
+	m, _, stop := newTestModuleService(t)
+	defer stop()
+
+	var mu sync.Mutex
+	steps := make([]string, 0)
+	step := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		steps = append(steps, s)
+	}
+	release := make(chan struct{})
+	md := &testModule{
+		name: "reinit",
+		init: func() error {
+			step("init")
+			return nil
+		},
+		stop: func() error {
+			step("stop")
+			return nil
+		},
+	}
+
+	started := make(chan struct{})
+	go m.call(md, "run", testChannel, func(ctx context.Context) error {
+		close(started)
+		<-release
+		step("run")
+		return nil
+	})
+	<-started
+	reinitialized := make(chan struct{})
+	go func() {
+		defer close(reinitialized)
+		m.reinitModule(md)
+	}()
+	select {
+	case <-reinitialized:
+		t.Fatal("reinitialized the module while it was running")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	<-reinitialized
+
+	// runs after the reinit see the new state
+	m.call(md, "run", testChannel, func(ctx context.Context) error {
+		step("run")
+		return nil
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"run", "stop", "init", "run"}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps %q, want %q", steps, want)
+	}
+}
+
+func TestCommandAliasPermissions(t *testing.T) {
+	m, _, stop := newTestModuleService(t)
+	defer stop()
+	m.commandRoles = map[string]acl.Role{"stats": acl.RoleTrusted}
+	var mu sync.Mutex
+	ran := make([]string, 0)
+	md := &testModule{
+		name:     "stats",
+		commands: []string{"stats", "toptod"},
+		events:   []string{modules.EventPrivmsg},
+		help:     []modules.CommandHelp{{Command: "stats", Aliases: []string{"toptod"}}},
+		handle: func(c *modules.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ran = append(ran, c.Source.Name+" "+c.Command)
+			return nil
+		},
+	}
+	if err := m.RegisterModules(md); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.acl.Add("trusted", acl.RoleTrusted, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	privmsg(m, "user!u@host", testChannel, "!stats")
+	privmsg(m, "user!u@host", testChannel, "!toptod")
+	privmsg(m, "trusted!t@host", testChannel, "!toptod")
+
+	mu.Lock()
+	defer mu.Unlock()
+	// the alias runs as the command it stands for
+	if want := []string{"trusted stats"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran %q, want %q", ran, want)
+	}
+}
+
+func TestCommandAliasCooldown(t *testing.T) {
+	m, sender, stop := newTestModuleService(t)
+	defer stop()
+	clock := scheduler.NewFakeClock(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	m.SetClock(clock)
+	m.cooldowns.setConfig(config.RateLimitConfiguration{Notice: true})
+	runs := 0
+	md := &testModule{
+		name:     "stats",
+		commands: []string{"stats", "toptod"},
+		events:   []string{modules.EventPrivmsg},
+		help:     []modules.CommandHelp{{Command: "stats", Aliases: []string{"toptod"}}},
+		cooldown: 30 * time.Second,
+		handle: func(c *modules.Context) error {
+			runs++
+			return nil
+		},
+	}
+	if err := m.RegisterModules(md); err != nil {
+		t.Fatal(err)
+	}
+
+	privmsg(m, "user!u@host", testChannel, "!stats")
+	clock.Advance(10 * time.Second)
+	privmsg(m, "user!u@host", testChannel, "!toptod")
+	privmsg(m, "user!u@host", testChannel, "!stats")
+	if runs != 1 {
+		t.Errorf("ran %d times within the cooldown, want 1", runs)
+	}
+	want := []string{"NOTICE user slow down, !stats is available again in 20s"}
+	if got := sender.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+
+	clock.Advance(20 * time.Second)
+	privmsg(m, "user!u@host", testChannel, "!toptod")
+	if runs != 2 {
+		t.Errorf("ran %d times after the cooldown, want 2", runs)
+	}
+}
+
+func TestEventTimeout(t *testing.T) {
+	m, _, stop := newTestModuleService(t)
+	defer stop()
+	m.timeout = 50 * time.Millisecond
+	stopped := make(chan error, 1)
+	md := &testModule{
+		name:   "listener",
+		events: []string{modules.EventJoin},
+		onEvent: func(ctx context.Context, e *modules.Event) error {
+			<-ctx.Done()
+			stopped <- ctx.Err()
+			return nil
+		},
+	}
+	if err := m.RegisterModules(md); err != nil {
+		t.Fatal(err)
+	}
+	m.EventCallback(girc.ParseEvent(":nick!u@h JOIN " + testChannel))
+	select {
+	case err := <-stopped:
+		if err != context.DeadlineExceeded {
+			t.Errorf("listener stopped with %v, want %v", err, context.DeadlineExceeded)
+		}
+	default:
+		t.Error("listener was not told to stop")
+	}
+}
+
+func TestStopCancelsRuns(t *testing.T) {
+	m, _, stop := newTestModuleService(t)
+	defer stop()
+	m.timeout = 0
+	m.breaker.SetConfig(config.ExecutionConfiguration{BreakerFailures: 1, BreakerWindow: 60, BreakerCooldown: 60})
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	md := &testModule{
+		name:     "slow",
+		commands: []string{"slow"},
+		events:   []string{modules.EventPrivmsg},
+		handle: func(c *modules.Context) error {
+			close(started)
+			<-c.Ctx.Done()
+			stopped <- c.Ctx.Err()
+			return nil
+		},
+	}
+	if err := m.RegisterModules(md); err != nil {
+		t.Fatal(err)
+	}
+	m.Dispatch(girc.ParseEvent(":nick!u@h PRIVMSG " + testChannel + " :!slow"))
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		m.StopModules()
+		close(done)
+	}()
+	select {
+	case err := <-stopped:
+		if err != context.Canceled {
+			t.Errorf("run stopped with %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(2 * shutdownTimeout):
+		t.Fatal("shutdown did not cancel the run")
+	}
+	<-done
+	if !m.enabled(testChannel, md) {
+		t.Error("a run cancelled by shutdown counted as a failure")
+	}
+}
+
+// testJobModule is a testModule with a scheduled job
+type testJobModule struct {
+	*testModule
+	jobs   []modules.Job
+	runJob func(ctx context.Context, jobName, channel string) error
+}
+
+func (m *testJobModule) Jobs() []modules.Job { return m.jobs }
+
+func (m *testJobModule) RunJob(ctx context.Context, jobName, channel string) error {
+	return m.runJob(ctx, jobName, channel)
+}
+
+func TestJobsRunInChannelOrder(t *testing.T) {
+	m, _, stop := newTestModuleService(t)
+	defer stop()
+	var mu sync.Mutex
+	handled := make([]string, 0)
+	record := func(entry string) {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, entry)
+	}
+	release := make(chan struct{})
+	md := &testJobModule{
+		testModule: &testModule{
+			name:     "stats",
+			commands: []string{"stats"},
+			events:   []string{modules.EventPrivmsg},
+			handle: func(c *modules.Context) error {
+				<-release
+				record("command")
+				return nil
+			},
+		},
+		jobs: []modules.Job{{Name: "daily", Spec: "@daily", Channels: []string{modules.AllChannels}}},
+		runJob: func(ctx context.Context, jobName, channel string) error {
+			record("job " + channel)
+			return nil
+		},
+	}
+	if err := m.RegisterModules(md); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Dispatch(girc.ParseEvent(":nick!u@h PRIVMSG " + testChannel + " :!stats"))
+	done := make(chan struct{})
+	go func() {
+		m.runJob(md, md.jobs[0])
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("job ran alongside a command of its channel")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("job did not run after the command")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"command", "job " + testChannel}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled %q, want %q", handled, want)
+	}
+}
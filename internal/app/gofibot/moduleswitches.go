@@ -0,0 +1,122 @@
+package gofibot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/lrstanley/girc"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	moduleSwitchBucket string = "Modules"
+
+	// allChannels is the channel of switches that apply everywhere
+	allChannels string = "*"
+)
+
+// moduleSwitches decides which modules run on which channels. Switches
+// set at runtime are stored in bbolt and take precedence over the
+// channel configuration, channel switches over switches for all channels.
+type moduleSwitches struct {
+	db *bolt.DB
+
+	mu       sync.RWMutex
+	config   map[string]config.ChannelModulesConfiguration
+	switches map[string]bool
+}
+
+func newModuleSwitches(db *bolt.DB, channels map[string]config.ChannelModulesConfiguration) (*moduleSwitches, error) {
+	s := &moduleSwitches{
+		db:       db,
+		switches: make(map[string]bool),
+	}
+	s.SetConfig(channels)
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(moduleSwitchBucket))
+		if err != nil {
+			return fmt.Errorf("could not create modules bucket: %v", err)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			s.switches[string(k)] = len(v) > 0 && v[0] == 1
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetConfig replaces the allow and deny lists of channels, switches set
+// at runtime still take precedence
+func (s *moduleSwitches) SetConfig(channels map[string]config.ChannelModulesConfiguration) {
+	byChannel := make(map[string]config.ChannelModulesConfiguration, len(channels))
+	for channel, cfg := range channels {
+		byChannel[girc.ToRFC1459(channel)] = cfg
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = byChannel
+}
+
+func switchKey(channel, module string) string {
+	return girc.ToRFC1459(channel) + " " + strings.ToLower(module)
+}
+
+// Enabled returns true if module runs on channel, channel is empty for
+// private messages
+func (s *moduleSwitches) Enabled(channel, module string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if channel != "" {
+		if enabled, ok := s.switches[switchKey(channel, module)]; ok {
+			return enabled
+		}
+	}
+	if enabled, ok := s.switches[switchKey(allChannels, module)]; ok {
+		return enabled
+	}
+	if channel == "" {
+		return true
+	}
+	cfg, ok := s.config[girc.ToRFC1459(channel)]
+	if !ok {
+		return true
+	}
+	if containsFold(cfg.Deny, module) {
+		return false
+	}
+	return len(cfg.Allow) == 0 || containsFold(cfg.Allow, module)
+}
+
+// Set enables or disables module on channel, or on every channel when
+// channel is allChannels
+func (s *moduleSwitches) Set(channel, module string, enabled bool) error {
+	key := switchKey(channel, module)
+	value := []byte{0}
+	if enabled {
+		value[0] = 1
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(moduleSwitchBucket)).Put([]byte(key), value)
+	})
+	if err != nil {
+		return err
+	}
+	s.switches[key] = enabled
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,151 @@
+package gofibot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestModuleSwitchesEnabled(t *testing.T) {
+	channelConfig := map[string]config.ChannelModulesConfiguration{
+		"#Allow": {Allow: []string{"Stats", "urltitle"}},
+		"#deny":  {Deny: []string{"urltitle"}},
+		"#both":  {Allow: []string{"urltitle"}, Deny: []string{"urltitle"}},
+	}
+	type toggle struct {
+		channel, module string
+		enabled         bool
+	}
+	tests := []struct {
+		name     string
+		switches []toggle
+		channel  string
+		module   string
+		want     bool
+	}{
+		{"default", nil, "#other", "urltitle", true},
+		{"private default", nil, "", "urltitle", true},
+		{"allowed", nil, "#allow", "stats", true},
+		{"not allowed", nil, "#allow", "guess", false},
+		{"channel names fold", nil, "#ALLOW", "urltitle", true},
+		{"denied", nil, "#deny", "urltitle", false},
+		{"not denied", nil, "#deny", "stats", true},
+		{"deny beats allow", nil, "#both", "urltitle", false},
+		{"global switch beats default", []toggle{{"*", "urltitle", false}}, "#other", "urltitle", false},
+		{"global switch applies to private", []toggle{{"*", "urltitle", false}}, "", "urltitle", false},
+		{"global switch beats deny", []toggle{{"*", "urltitle", true}}, "#deny", "urltitle", true},
+		{"global switch beats allow", []toggle{{"*", "guess", true}}, "#allow", "guess", true},
+		{"channel switch beats deny", []toggle{{"#deny", "urltitle", true}}, "#deny", "urltitle", true},
+		{"channel switch beats allow", []toggle{{"#allow", "stats", false}}, "#allow", "stats", false},
+		{"channel switch beats global", []toggle{{"*", "urltitle", false}, {"#other", "urltitle", true}}, "#other", "urltitle", true},
+		{"global switch beats other channels", []toggle{{"*", "urltitle", false}, {"#other", "urltitle", true}}, "#third", "urltitle", false},
+		{"channel switch ignores private", []toggle{{"#other", "urltitle", false}}, "", "urltitle", true},
+		{"module names fold", []toggle{{"#Other", "URLTitle", false}}, "#other", "urltitle", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, close := openTestDB(t)
+			defer close()
+			s, err := newModuleSwitches(db, channelConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, sw := range tt.switches {
+				if err := s.Set(sw.channel, sw.module, sw.enabled); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := s.Enabled(tt.channel, tt.module); got != tt.want {
+				t.Errorf("Enabled(%q, %q) = %v, want %v", tt.channel, tt.module, got, tt.want)
+			}
+
+			// switches are stored and outlive configuration changes
+			s, err = newModuleSwitches(db, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.SetConfig(channelConfig)
+			if got := s.Enabled(tt.channel, tt.module); got != tt.want {
+				t.Errorf("Enabled(%q, %q) after reloading = %v, want %v", tt.channel, tt.module, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModuleSwitchesSetConfig(t *testing.T) {
+	db, close := openTestDB(t)
+	defer close()
+	s, err := newModuleSwitches(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Enabled("#chan", "urltitle") {
+		t.Fatal("disabled without configuration")
+	}
+	s.SetConfig(map[string]config.ChannelModulesConfiguration{"#chan": {Deny: []string{"urltitle"}}})
+	if s.Enabled("#chan", "urltitle") {
+		t.Error("enabled after the configuration denied it")
+	}
+	s.SetConfig(nil)
+	if !s.Enabled("#chan", "urltitle") {
+		t.Error("disabled after the configuration was removed")
+	}
+}
+
+// openTestDB opens a database in a temporary directory, close removes it
+func openTestDB(t *testing.T) (db *bolt.DB, close func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "gofibot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = bolt.Open(filepath.Join(dir, "test.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestReloadReinitsSwitchedModules(t *testing.T) {
+	m, _, stop := newTestModuleService(t)
+	defer stop()
+	inits := make(map[string]int)
+	newModule := func(name string) *testModule {
+		return &testModule{name: name, init: func() error {
+			inits[name]++
+			return nil
+		}}
+	}
+	if err := m.RegisterModules(newModule("urltitle"), newModule("stats")); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.BotConfiguration{
+		Channels:       []string{testChannel},
+		Prefix:         "!",
+		ChannelModules: map[string]config.ChannelModulesConfiguration{testChannel: {Deny: []string{"urltitle"}}},
+	}
+	if err := m.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	// a runtime switch keeps the module disabled when the denial is removed
+	m.switches.Set(testChannel, "urltitle", false)
+	cfg.ChannelModules = nil
+	if err := m.Reload(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"urltitle": 2, "stats": 1}; !reflect.DeepEqual(inits, want) {
+		t.Errorf("initialized %v, want %v", inits, want)
+	}
+}
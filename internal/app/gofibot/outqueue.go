@@ -0,0 +1,252 @@
+package gofibot
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/ratelimit"
+	"github.com/huqa/gofibot/internal/pkg/utils"
+	"github.com/lrstanley/girc"
+)
+
+// Priority of an outgoing message, high priority messages are sent first
+type Priority int
+
+// Message priorities
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+)
+
+const (
+	// ircMessageLength is the longest irc message without the trailing CRLF
+	ircMessageLength int = 510
+	// maxHostLength is used when our own host is not known yet
+	maxHostLength int = 63
+	// actionLength is the length of the CTCP ACTION framing
+	actionLength int = len("\x01ACTION \x01")
+
+	truncatedFormat string = " …(%d more)"
+
+	// idleWait is how long the queue sleeps when there is nothing to send
+	idleWait time.Duration = time.Hour
+)
+
+// outMessage is a single queued irc command
+type outMessage struct {
+	command string
+	target  string
+	params  []string
+}
+
+// outQueue sends messages to irc with a token bucket per target and a
+// global one, splitting long messages to lines that fit in irc messages
+type outQueue struct {
+	log    logger.Logger
+	cfg    config.FloodConfiguration
+	client *girc.Client
+
+	mu      sync.Mutex
+	queues  [2][]*outMessage
+	buckets map[string]*ratelimit.TokenBucket
+	global  *ratelimit.TokenBucket
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+
+	stopOnce sync.Once
+}
+
+func newOutQueue(log logger.Logger, cfg config.FloodConfiguration, client *girc.Client) *outQueue {
+	if cfg.Rate <= 0 || cfg.GlobalRate <= 0 {
+		defaults := config.DefaultFloodConfiguration()
+		cfg.Rate, cfg.Burst = defaults.Rate, defaults.Burst
+		cfg.GlobalRate, cfg.GlobalBurst = defaults.GlobalRate, defaults.GlobalBurst
+	}
+	return &outQueue{
+		log:     log.Named("outqueue"),
+		cfg:     cfg,
+		client:  client,
+		buckets: make(map[string]*ratelimit.TokenBucket),
+		global:  ratelimit.NewTokenBucket(cfg.GlobalRate, cfg.GlobalBurst, time.Now()),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start starts sending queued messages
+func (q *outQueue) Start() {
+	go q.run()
+}
+
+// Stop stops sending, messages still in the queue are dropped. Stopping
+// again does nothing.
+func (q *outQueue) Stop() {
+	q.stopOnce.Do(func() {
+		close(q.stop)
+	})
+	<-q.done
+}
+
+// Push queues a command. PRIVMSG, NOTICE and ACTION texts are split to
+// lines and truncated to MaxLines.
+func (q *outQueue) Push(priority Priority, command, target string, params ...string) {
+	messages := make([]*outMessage, 0)
+	switch command {
+	case girc.PRIVMSG, girc.NOTICE, girc.CTCP_ACTION:
+		for _, line := range q.lines(command, target, params[0]) {
+			messages = append(messages, &outMessage{command: command, target: target, params: []string{line}})
+		}
+	default:
+		messages = append(messages, &outMessage{command: command, target: target, params: params})
+	}
+	if len(messages) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	if priority == PriorityNormal && q.cfg.QueueSize > 0 && q.length()+len(messages) > q.cfg.QueueSize {
+		q.mu.Unlock()
+		q.log.Errorf("queue full, dropping %d lines to %s", len(messages), target)
+		return
+	}
+	q.queues[priority] = append(q.queues[priority], messages...)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// lines splits text to lines that fit an irc message to target
+func (q *outQueue) lines(command, target, text string) []string {
+	maxBytes := q.lineLength(command, target)
+	lines := utils.SplitMessage(text, maxBytes)
+	if q.cfg.MaxLines > 0 && len(lines) > q.cfg.MaxLines {
+		suffix := fmt.Sprintf(truncatedFormat, len(lines)-q.cfg.MaxLines)
+		lines = lines[:q.cfg.MaxLines]
+		last := len(lines) - 1
+		lines[last] = utils.Truncate(lines[last], maxBytes-len(suffix)) + suffix
+	}
+	return lines
+}
+
+// lineLength returns how many bytes of text fit in a single message
+func (q *outQueue) lineLength(command, target string) int {
+	if q.cfg.LineLength > 0 {
+		return q.cfg.LineLength
+	}
+	host := q.client.GetHost()
+	hostLength := len(host)
+	if host == "" {
+		hostLength = maxHostLength
+	}
+	// ":nick!ident@host "
+	prefix := len(q.client.GetNick()) + len(q.client.GetIdent()) + hostLength + 4
+	// "PRIVMSG target :"
+	length := ircMessageLength - prefix - len(girc.PRIVMSG) - len(target) - 3
+	if command == girc.CTCP_ACTION {
+		length -= actionLength
+	}
+	return length
+}
+
+func (q *outQueue) length() int {
+	return len(q.queues[PriorityNormal]) + len(q.queues[PriorityHigh])
+}
+
+func (q *outQueue) run() {
+	defer close(q.done)
+	for {
+		wait := q.sendReady()
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// sendReady sends every message allowed by the rate limits and returns
+// how long to wait before the next message can be sent
+func (q *outQueue) sendReady() time.Duration {
+	ready, wait := q.ready(time.Now())
+	for _, m := range ready {
+		q.send(m)
+	}
+	return wait
+}
+
+// ready removes and returns the messages allowed by the rate limits at
+// now, high priority first, and how long to wait before the next message
+// can be sent. Messages to the same target keep their order.
+func (q *outQueue) ready(now time.Time) ([]*outMessage, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	wait := idleWait
+	ready := make([]*outMessage, 0)
+	blocked := make(map[string]bool)
+	for p := PriorityHigh; p >= PriorityNormal; p-- {
+		pending := q.queues[p][:0]
+		for _, m := range q.queues[p] {
+			key := girc.ToRFC1459(m.target)
+			if blocked[key] {
+				pending = append(pending, m)
+				continue
+			}
+			bucket := q.bucket(key, now)
+			w := bucket.Wait(now)
+			if gw := q.global.Wait(now); gw > w {
+				w = gw
+			}
+			if w > 0 {
+				blocked[key] = true
+				if w < wait {
+					wait = w
+				}
+				pending = append(pending, m)
+				continue
+			}
+			bucket.Take(now)
+			q.global.Take(now)
+			ready = append(ready, m)
+		}
+		q.queues[p] = pending
+	}
+	for key, bucket := range q.buckets {
+		if !blocked[key] && bucket.Full(now) {
+			delete(q.buckets, key)
+		}
+	}
+	return ready, wait
+}
+
+func (q *outQueue) bucket(key string, now time.Time) *ratelimit.TokenBucket {
+	bucket, ok := q.buckets[key]
+	if !ok {
+		bucket = ratelimit.NewTokenBucket(q.cfg.Rate, q.cfg.Burst, now)
+		q.buckets[key] = bucket
+	}
+	return bucket
+}
+
+func (q *outQueue) send(m *outMessage) {
+	switch m.command {
+	case girc.PRIVMSG:
+		q.client.Cmd.Message(m.target, m.params[0])
+	case girc.NOTICE:
+		q.client.Cmd.Notice(m.target, m.params[0])
+	case girc.CTCP_ACTION:
+		q.client.Cmd.Action(m.target, m.params[0])
+	case girc.TOPIC:
+		q.client.Cmd.Topic(m.target, m.params[0])
+	case girc.KICK:
+		q.client.Cmd.Kick(m.target, m.params[0], m.params[1])
+	}
+}
@@ -0,0 +1,130 @@
+package gofibot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/lrstanley/girc"
+	"go.uber.org/zap"
+)
+
+func newTestQueue(cfg config.FloodConfiguration) *outQueue {
+	log := &logger.LogWrapper{SugaredLogger: zap.NewNop().Sugar()}
+	// with a line length the queue does not need a client until it sends
+	return newOutQueue(log, cfg, nil)
+}
+
+// texts returns the targets and texts of messages
+func texts(messages []*outMessage) []string {
+	list := make([]string, 0, len(messages))
+	for _, m := range messages {
+		list = append(list, m.target+" "+m.params[0])
+	}
+	return list
+}
+
+func TestOutQueueLines(t *testing.T) {
+	q := newTestQueue(config.FloodConfiguration{
+		Rate: 1, Burst: 1, GlobalRate: 1, GlobalBurst: 1,
+		LineLength: 20,
+		MaxLines:   2,
+	})
+
+	lines := q.lines(girc.PRIVMSG, testChannel, "ääkkösiä ja öljyä, hyvää yötä")
+	if len(lines) != 2 {
+		t.Fatalf("split to %q, want 2 lines", lines)
+	}
+	for _, line := range lines {
+		if len(line) > 20 || !utf8.ValidString(line) {
+			t.Errorf("line %q is over 20 bytes or not valid UTF-8", line)
+		}
+	}
+
+	lines = q.lines(girc.PRIVMSG, testChannel, "one\ntwo\nthree\nfour\nfive")
+	if want := []string{"one", "two …(3 more)"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("truncated to %q, want %q", lines, want)
+	}
+
+	// the suffix replaces the end of a full last line
+	lines = q.lines(girc.PRIVMSG, testChannel, strings.Repeat("ä", 30))
+	last := lines[len(lines)-1]
+	if len(lines) != 2 || len(last) > 20 || !utf8.ValidString(last) || !strings.HasSuffix(last, " …(1 more)") {
+		t.Errorf("truncated to %q", lines)
+	}
+}
+
+func TestOutQueuePriority(t *testing.T) {
+	q := newTestQueue(config.FloodConfiguration{
+		Rate: 1, Burst: 1, GlobalRate: 100, GlobalBurst: 100,
+		LineLength: 100,
+	})
+	now := time.Now()
+
+	q.Push(PriorityNormal, girc.PRIVMSG, "#a", "first")
+	q.Push(PriorityNormal, girc.PRIVMSG, "#a", "second")
+	q.Push(PriorityHigh, girc.PRIVMSG, "#a", "urgent")
+	q.Push(PriorityNormal, girc.PRIVMSG, "#b", "other")
+
+	ready, wait := q.ready(now)
+	if want := []string{"#a urgent", "#b other"}; !reflect.DeepEqual(texts(ready), want) {
+		t.Errorf("sent %q, want %q", texts(ready), want)
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait %s, want at most a second", wait)
+	}
+	// one token per second per target, in order
+	ready, _ = q.ready(now.Add(time.Second))
+	if want := []string{"#a first"}; !reflect.DeepEqual(texts(ready), want) {
+		t.Errorf("sent %q after a second, want %q", texts(ready), want)
+	}
+	ready, _ = q.ready(now.Add(2 * time.Second))
+	if want := []string{"#a second"}; !reflect.DeepEqual(texts(ready), want) {
+		t.Errorf("sent %q after two seconds, want %q", texts(ready), want)
+	}
+	if ready, wait = q.ready(now.Add(time.Hour)); len(ready) != 0 || wait != idleWait {
+		t.Errorf("sent %q from an empty queue, wait %s", texts(ready), wait)
+	}
+}
+
+func TestOutQueueGlobalLimit(t *testing.T) {
+	q := newTestQueue(config.FloodConfiguration{
+		Rate: 100, Burst: 100, GlobalRate: 1, GlobalBurst: 2,
+		LineLength: 100,
+	})
+	now := time.Now()
+	for _, target := range []string{"#a", "#b", "#c"} {
+		q.Push(PriorityNormal, girc.PRIVMSG, target, "hello")
+	}
+	if ready, _ := q.ready(now); len(ready) != 2 {
+		t.Errorf("sent %q, want the global burst of 2", texts(ready))
+	}
+	if ready, _ := q.ready(now.Add(time.Second)); len(ready) != 1 {
+		t.Errorf("sent %q after a second, want 1", texts(ready))
+	}
+}
+
+func TestOutQueueFull(t *testing.T) {
+	q := newTestQueue(config.FloodConfiguration{
+		Rate: 1, Burst: 1, GlobalRate: 1, GlobalBurst: 1,
+		LineLength: 100,
+		QueueSize:  2,
+	})
+	q.Push(PriorityNormal, girc.PRIVMSG, "#a", "one\ntwo")
+	q.Push(PriorityNormal, girc.PRIVMSG, "#a", "dropped")
+	q.Push(PriorityHigh, girc.PRIVMSG, "#a", "kept")
+	if n := q.length(); n != 3 {
+		t.Errorf("queued %d lines, want 3", n)
+	}
+}
+
+func TestOutQueueStopTwice(t *testing.T) {
+	q := newTestQueue(config.DefaultFloodConfiguration())
+	q.Start()
+	q.Stop()
+	q.Stop()
+}
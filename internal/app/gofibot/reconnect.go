@@ -0,0 +1,177 @@
+package gofibot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+)
+
+// ConnectionState is the state of the IRCService connection loop
+type ConnectionState int
+
+// Connection states
+const (
+	StateStopped ConnectionState = iota
+	StateConnecting
+	StateConnected
+	StateBackoff
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateStopped:
+		return "stopped"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateBackoff:
+		return "backoff"
+	default:
+		return "unknown"
+	}
+}
+
+// serverAddress is a single server to connect to
+type serverAddress struct {
+	host string
+	port int
+}
+
+func (s serverAddress) String() string {
+	return net.JoinHostPort(s.host, strconv.Itoa(s.port))
+}
+
+// serverList returns the main server followed by the configured
+// alternatives in "host" or "host:port" form
+func serverList(cfg config.BotConfiguration) []serverAddress {
+	servers := []serverAddress{{host: cfg.Server, port: cfg.Port}}
+	for _, s := range cfg.Servers {
+		host, portStr, err := net.SplitHostPort(s)
+		if err != nil {
+			servers = append(servers, serverAddress{host: s, port: cfg.Port})
+			continue
+		}
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			port = cfg.Port
+		}
+		servers = append(servers, serverAddress{host: host, port: port})
+	}
+	return servers
+}
+
+// backoff calculates exponential backoff delays with jitter
+type backoff struct {
+	cfg  config.ReconnectConfiguration
+	rand *rand.Rand
+}
+
+func newBackoff(cfg config.ReconnectConfiguration) *backoff {
+	if cfg.InitialDelay <= 0 {
+		cfg.InitialDelay = 1
+	}
+	if cfg.MaxDelay < cfg.InitialDelay {
+		cfg.MaxDelay = cfg.InitialDelay
+	}
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = 1
+	}
+	if cfg.Jitter < 0 || cfg.Jitter > 1 {
+		cfg.Jitter = 0
+	}
+	return &backoff{
+		cfg:  cfg,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// delay returns the wait time before the given attempt, attempts start at 1
+func (b *backoff) delay(attempt int) time.Duration {
+	initial := float64(time.Duration(b.cfg.InitialDelay) * time.Second)
+	max := float64(time.Duration(b.cfg.MaxDelay) * time.Second)
+	d := math.Min(initial*math.Pow(b.cfg.Multiplier, float64(attempt-1)), max)
+	if b.cfg.Jitter > 0 {
+		d += d * b.cfg.Jitter * (b.rand.Float64()*2 - 1)
+	}
+	return time.Duration(math.Min(d, max))
+}
+
+// Run connects to the configured servers and keeps reconnecting with
+// exponential backoff until ctx is cancelled or MaxAttempts consecutive
+// attempts have failed
+func (is *IRCService) Run(ctx context.Context) error {
+	defer is.setState(StateStopped)
+
+	cfg := is.configuration()
+	servers := serverList(cfg)
+	backoff := newBackoff(cfg.Reconnect)
+	attempt := 0
+	for i := 0; ; i = (i + 1) % len(servers) {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		server := servers[i]
+		is.setState(StateConnecting)
+		is.client.Config.Server = server.host
+		is.client.Config.Port = server.port
+		err := is.Connect()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if is.wasConnected() {
+			// a working connection was lost, start over
+			attempt = 0
+		}
+		attempt++
+		if err == nil {
+			err = fmt.Errorf("connection to %s closed", server)
+		}
+		is.log.Error("connection error: ", err)
+
+		if cfg.Reconnect.MaxAttempts > 0 && attempt >= cfg.Reconnect.MaxAttempts {
+			return fmt.Errorf("giving up after %d connection attempts: %v", attempt, err)
+		}
+
+		delay := backoff.delay(attempt)
+		is.setState(StateBackoff)
+		is.log.Infof("reconnecting to %s in %s (attempt %d)", servers[(i+1)%len(servers)], delay.Round(time.Second), attempt+1)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// State returns the current connection state
+func (is *IRCService) State() ConnectionState {
+	is.stateMu.Lock()
+	defer is.stateMu.Unlock()
+	return is.state
+}
+
+func (is *IRCService) setState(state ConnectionState) {
+	is.stateMu.Lock()
+	defer is.stateMu.Unlock()
+	if state == StateConnected {
+		is.connected = true
+	} else if state == StateConnecting {
+		is.connected = false
+	}
+	is.state = state
+}
+
+// wasConnected reports if the last connection attempt reached registration
+func (is *IRCService) wasConnected() bool {
+	is.stateMu.Lock()
+	defer is.stateMu.Unlock()
+	return is.connected
+}
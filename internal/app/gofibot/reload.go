@@ -0,0 +1,259 @@
+package gofibot
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+	"github.com/huqa/gofibot/internal/pkg/modules"
+	"github.com/lrstanley/girc"
+)
+
+// configPollInterval is how often the configuration file is checked
+// for changes
+const configPollInterval time.Duration = 5 * time.Second
+
+// Reload reads the bot configuration file again and applies it with the
+// command line overrides without reconnecting
+func (a *Application) Reload() error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+	cfg, err := config.LoadBotConfiguration(a.configPath, a.overrides)
+	if err != nil {
+		return fmt.Errorf("can't load bot configuration: %v", err)
+	}
+	a.log.Info("reloading configuration from ", a.configPath)
+	return a.IRCService.Reload(cfg)
+}
+
+// watchConfig reloads the configuration when its file changes until
+// Shutdown is called
+func (a *Application) watchConfig() {
+	modified := func() time.Time {
+		info, err := os.Stat(a.configPath)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	last := modified()
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		mod := modified()
+		if mod.IsZero() || mod.Equal(last) {
+			continue
+		}
+		last = mod
+		if err := a.Reload(); err != nil {
+			a.log.Error("can't reload configuration: ", err)
+		}
+	}
+}
+
+// OnReload sets the function the !reload command calls
+func (is *IRCService) OnReload(reload func() error) {
+	is.moduleService.OnReload(reload)
+}
+
+// Reload applies cfg without reconnecting. Channels are joined and
+// parted and the nick is changed right away, settings of the connection
+// itself are only logged and need a restart.
+func (is *IRCService) Reload(cfg config.BotConfiguration) error {
+	if err := is.moduleService.Reload(cfg); err != nil {
+		return err
+	}
+
+	is.configMu.Lock()
+	old := is.config
+	is.config.Channels = cfg.Channels
+	is.config.Nick = cfg.Nick
+	is.configMu.Unlock()
+
+	if changed := restartFields(old, cfg); len(changed) > 0 {
+		is.log.Infof("changes to %s take effect after a restart", strings.Join(changed, ", "))
+	}
+	if is.State() != StateConnected {
+		return nil
+	}
+	if cfg.Nick != old.Nick {
+		is.client.Cmd.Nick(cfg.Nick)
+	}
+	for _, ch := range cfg.Channels {
+		if !containsChannel(old.Channels, ch) {
+			is.log.Info("joining channel: ", ch)
+			is.client.Cmd.Join(ch)
+		}
+	}
+	for _, ch := range old.Channels {
+		if !containsChannel(cfg.Channels, ch) {
+			is.log.Info("parting channel: ", ch)
+			is.client.Cmd.Part(ch)
+		}
+	}
+	return nil
+}
+
+// restartFields returns the names of settings that changed between old
+// and cfg but can't be changed while connected
+func restartFields(old, cfg config.BotConfiguration) []string {
+	changed := make([]string, 0)
+	check := func(name string, a, b interface{}) {
+		if !reflect.DeepEqual(a, b) {
+			changed = append(changed, name)
+		}
+	}
+	check("ident", old.Ident, cfg.Ident)
+	check("realname", old.Realname, cfg.Realname)
+	check("server", old.Server, cfg.Server)
+	check("servers", old.Servers, cfg.Servers)
+	check("port", old.Port, cfg.Port)
+	check("tls", []interface{}{old.TLS, old.TLSVerify, old.TLSCert, old.TLSKey}, []interface{}{cfg.TLS, cfg.TLSVerify, cfg.TLSCert, cfg.TLSKey})
+	check("sasl", old.SASL, cfg.SASL)
+	check("nickserv", old.NickServ, cfg.NickServ)
+	check("database.path", old.Database.Path, cfg.Database.Path)
+	check("location", old.Location, cfg.Location)
+	check("reconnect", old.Reconnect, cfg.Reconnect)
+	check("flood", old.Flood, cfg.Flood)
+	check("execution.workers", old.Execution.Workers, cfg.Execution.Workers)
+	check("execution.queueSize", old.Execution.QueueSize, cfg.Execution.QueueSize)
+	return changed
+}
+
+func containsChannel(channels []string, channel string) bool {
+	for _, ch := range channels {
+		if girc.ToRFC1459(ch) == girc.ToRFC1459(channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// OnReload sets the function the !reload command calls
+func (m *ModuleService) OnReload(reload func() error) {
+	m.reload = reload
+}
+
+// Reload applies cfg to ModuleService. Modules that are enabled or
+// disabled on some channel by the change, or whose jobs are scheduled
+// differently, are stopped, initialized again and rescheduled.
+func (m *ModuleService) Reload(cfg config.BotConfiguration) error {
+	moduleRoles, err := parseRoles(cfg.Permissions.Modules)
+	if err != nil {
+		return err
+	}
+	commandRoles, err := parseRoles(cfg.Permissions.Commands)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	channels := append(append([]string{}, m.channels...), cfg.Channels...)
+	oldSchedules := m.schedules
+	oldDatabase := m.database
+	m.mu.RUnlock()
+
+	before := m.enablement(channels)
+	m.switches.SetConfig(cfg.ChannelModules)
+	after := m.enablement(channels)
+
+	m.mu.Lock()
+	m.channels = cfg.Channels
+	m.schedules = cfg.Schedules
+	m.Prefix = cfg.Prefix
+	m.prefixes = channelPrefixes(cfg.Prefixes)
+	m.moduleRoles = moduleRoles
+	m.commandRoles = commandRoles
+	m.timeout = time.Duration(cfg.Execution.Timeout) * time.Second
+	m.notify = cfg.Execution.Notify
+	m.database = cfg.Database
+	m.mu.Unlock()
+
+	m.acl.SetOwners(cfg.Owners)
+	m.cooldowns.setConfig(cfg.RateLimit)
+	m.breaker.SetConfig(cfg.Execution)
+	if oldDatabase.BackupSpec != cfg.Database.BackupSpec {
+		if err := m.scheduleBackup(cfg.Database); err != nil {
+			m.log.Error("can't schedule backups: ", err)
+		}
+	}
+
+	for _, md := range m.modules {
+		if md.Name() == coreModuleName {
+			continue
+		}
+		if before[md.Name()] == after[md.Name()] && !jobsChanged(md, oldSchedules, cfg.Schedules) {
+			continue
+		}
+		m.reinitModule(md)
+	}
+	return nil
+}
+
+// enablement returns for each module a string telling on which of
+// channels it is enabled
+func (m *ModuleService) enablement(channels []string) map[string]string {
+	states := make(map[string]string, len(m.modules))
+	for _, md := range m.modules {
+		var state strings.Builder
+		for _, channel := range channels {
+			if m.switches.Enabled(channel, md.Name()) {
+				state.WriteByte('1')
+			} else {
+				state.WriteByte('0')
+			}
+		}
+		states[md.Name()] = state.String()
+	}
+	return states
+}
+
+// jobsChanged returns true if the configuration of a job of md differs
+// between old and schedules
+func jobsChanged(md modules.ModuleInterface, old, schedules map[string]config.ScheduleConfiguration) bool {
+	scheduled, ok := md.(modules.Scheduled)
+	if !ok {
+		return false
+	}
+	for _, job := range scheduled.Jobs() {
+		name := md.Name() + "/" + job.Name
+		if !reflect.DeepEqual(old[name], schedules[name]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reinitModule stops md, initializes it again and reschedules its jobs.
+// It waits for running events and jobs of md to finish first.
+func (m *ModuleService) reinitModule(md modules.ModuleInterface) {
+	m.log.Infof("reinitializing module %s", md.Name())
+	lock := m.moduleLock(md)
+	lock.Lock()
+	if err := md.Stop(); err != nil {
+		m.log.Errorf("error stopping module %s: %v", md.Name(), err)
+	}
+	err := md.Init()
+	lock.Unlock()
+	if err != nil {
+		m.log.Errorf("error initializing module %s: %v", md.Name(), err)
+		return
+	}
+	scheduled, ok := md.(modules.Scheduled)
+	if !ok {
+		return
+	}
+	for _, job := range scheduled.Jobs() {
+		if err := m.addJob(md, job); err != nil {
+			m.log.Errorf("can't reschedule %s: %v", md.Name(), err)
+		}
+	}
+}
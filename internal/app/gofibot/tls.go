@@ -0,0 +1,60 @@
+package gofibot
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/config"
+)
+
+const dialTimeout time.Duration = 10 * time.Second
+
+// tlsDialer implements girc.Dialer and completes the TLS handshake
+// before handing the connection to girc, so handshake failures are
+// reported on connect instead of as a generic write error
+type tlsDialer struct {
+	config *tls.Config
+}
+
+// newTLSConfig builds a tls.Config from the bot configuration
+func newTLSConfig(cfg config.BotConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: !cfg.TLSVerify,
+	}
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		if cfg.TLSCert == "" || cfg.TLSKey == "" {
+			return nil, fmt.Errorf("both tlsCert and tlsKey are required for a client certificate")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("can't load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Dial connects to address and performs the TLS handshake
+func (d *tlsDialer) Dial(network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout(network, address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	// servers are rotated, verify against the one we dialed
+	config := d.config.Clone()
+	config.ServerName = host
+	tlsConn := tls.Client(conn, config)
+	tlsConn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("tls handshake with %s failed: %v", address, err)
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
@@ -0,0 +1,143 @@
+package gofibot
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/logger"
+)
+
+// workerPool runs event handlers on a fixed number of workers. Jobs with
+// the same key, e.g. the same channel, always run on the same worker in
+// the order they were submitted. Jobs are dropped when the queue of a
+// worker is full so the irc connection is never blocked.
+type workerPool struct {
+	// counters come first to keep them aligned for atomic access
+	submitted uint64
+	processed uint64
+	dropped   uint64
+	maxQueued int64
+
+	log    logger.Logger
+	queues []chan func()
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// workerStats describes the load of a workerPool
+type workerStats struct {
+	Workers   int
+	Queued    int
+	MaxQueued int64
+	Submitted uint64
+	Processed uint64
+	Dropped   uint64
+}
+
+func newWorkerPool(log logger.Logger, workers, queueSize int) *workerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &workerPool{
+		log:    log.Named("workerpool"),
+		queues: make([]chan func(), workers),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan func(), queueSize)
+	}
+	return p
+}
+
+// Start starts the workers
+func (p *workerPool) Start() {
+	for _, queue := range p.queues {
+		p.wg.Add(1)
+		go p.work(queue)
+	}
+}
+
+func (p *workerPool) work(queue chan func()) {
+	defer p.wg.Done()
+	for job := range queue {
+		job()
+		atomic.AddUint64(&p.processed, 1)
+	}
+}
+
+// Submit queues job after earlier jobs with the same key. It returns
+// false if the job was dropped because the queue is full or the pool
+// is stopped.
+func (p *workerPool) Submit(key string, job func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	queue := p.queues[p.index(key)]
+	select {
+	case queue <- job:
+		atomic.AddUint64(&p.submitted, 1)
+		if n := int64(len(queue)); n > atomic.LoadInt64(&p.maxQueued) {
+			atomic.StoreInt64(&p.maxQueued, n)
+		}
+		return true
+	default:
+		dropped := atomic.AddUint64(&p.dropped, 1)
+		p.log.Errorf("worker queue full, dropped event for %s (%d dropped in total)", key, dropped)
+		return false
+	}
+}
+
+func (p *workerPool) index(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// Stop stops accepting jobs and waits until queued jobs are done or
+// timeout has passed. It returns false on timeout.
+func (p *workerPool) Stop(timeout time.Duration) bool {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return true
+	}
+	p.closed = true
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return true
+	case <-time.After(timeout):
+		p.log.Errorf("%d events left unhandled after %s", p.Stats().Queued, timeout)
+		return false
+	}
+}
+
+// Stats returns the current load of the pool
+func (p *workerPool) Stats() workerStats {
+	queued := 0
+	for _, queue := range p.queues {
+		queued += len(queue)
+	}
+	return workerStats{
+		Workers:   len(p.queues),
+		Queued:    queued,
+		MaxQueued: atomic.LoadInt64(&p.maxQueued),
+		Submitted: atomic.LoadUint64(&p.submitted),
+		Processed: atomic.LoadUint64(&p.processed),
+		Dropped:   atomic.LoadUint64(&p.dropped),
+	}
+}
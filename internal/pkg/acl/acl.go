@@ -0,0 +1,238 @@
+// Package acl defines roles for users and stores them in bbolt
+package acl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lrstanley/girc"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	aclBucket string = "ACL"
+
+	// AccountPrefix marks masks that match NickServ accounts
+	AccountPrefix string = "$a:"
+)
+
+// Role is a users permission level, higher roles may do everything the
+// lower roles can
+type Role int
+
+// Roles from lowest to highest, RoleUser is the zero value
+const (
+	RoleIgnored Role = iota - 1
+	RoleUser
+	RoleTrusted
+	RoleAdmin
+	RoleOwner
+)
+
+var roleNames = map[Role]string{
+	RoleIgnored: "ignored",
+	RoleUser:    "user",
+	RoleTrusted: "trusted",
+	RoleAdmin:   "admin",
+	RoleOwner:   "owner",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+// CanManage returns true if a user with role may grant, remove or ignore
+// target. Owners may manage everyone, others only lower roles.
+func CanManage(role, target Role) bool {
+	return role == RoleOwner || target < role
+}
+
+// ParseRole returns the Role called name
+func ParseRole(name string) (Role, error) {
+	for role, n := range roleNames {
+		if strings.EqualFold(n, name) {
+			return role, nil
+		}
+	}
+	return RoleUser, fmt.Errorf("unknown role: %s", name)
+}
+
+// Entry grants Role to users matching Mask
+type Entry struct {
+	Mask    string
+	Role    Role
+	AddedBy string
+	Added   time.Time
+}
+
+// NormalizeMask lowercases mask and expands plain nicks to nick!*@*
+func NormalizeMask(mask string) string {
+	mask = strings.ToLower(strings.TrimSpace(mask))
+	if strings.HasPrefix(mask, AccountPrefix) {
+		return mask
+	}
+	if !strings.ContainsAny(mask, "!@") {
+		return mask + "!*@*"
+	}
+	return mask
+}
+
+// Match returns true if mask matches hostmask or account. Account masks
+// are written as $a:account.
+func Match(mask, hostmask, account string) bool {
+	mask = NormalizeMask(mask)
+	if strings.HasPrefix(mask, AccountPrefix) {
+		return account != "" && girc.Glob(strings.ToLower(account), mask[len(AccountPrefix):])
+	}
+	return girc.Glob(strings.ToLower(hostmask), mask)
+}
+
+// MatchesEveryone returns true if mask is made of wildcards only and so
+// matches every user
+func MatchesEveryone(mask string) bool {
+	mask = NormalizeMask(mask)
+	mask = strings.TrimPrefix(mask, AccountPrefix)
+	return strings.Trim(mask, "*?!@") == ""
+}
+
+// ACL stores role entries in bbolt and caches them in memory. Owners given
+// on construction always have RoleOwner and are not stored.
+type ACL struct {
+	db *bolt.DB
+
+	mu      sync.RWMutex
+	owners  []string
+	entries map[string]Entry
+}
+
+// New constructs an ACL and loads its entries from db
+func New(db *bolt.DB, owners []string) (*ACL, error) {
+	a := &ACL{
+		db:      db,
+		owners:  owners,
+		entries: make(map[string]Entry),
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(aclBucket))
+		if err != nil {
+			return fmt.Errorf("could not create acl bucket: %v", err)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("invalid acl entry %s: %v", k, err)
+			}
+			a.entries[string(k)] = e
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// SetOwners replaces the owner masks
+func (a *ACL) SetOwners(owners []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.owners = owners
+}
+
+// Role returns the highest role matching hostmask or account. Users
+// without entries have RoleUser.
+func (a *ACL) Role(hostmask, account string) Role {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	for _, mask := range a.owners {
+		if Match(mask, hostmask, account) {
+			return RoleOwner
+		}
+	}
+	role := RoleUser
+	matched := false
+	for _, e := range a.entries {
+		if !Match(e.Mask, hostmask, account) {
+			continue
+		}
+		if !matched || e.Role > role {
+			role = e.Role
+		}
+		matched = true
+	}
+	return role
+}
+
+// Add stores an entry granting role to mask
+func (a *ACL) Add(mask string, role Role, addedBy string) (Entry, error) {
+	e := Entry{
+		Mask:    NormalizeMask(mask),
+		Role:    role,
+		AddedBy: addedBy,
+		Added:   time.Now(),
+	}
+	enc, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(aclBucket)).Put([]byte(e.Mask), enc)
+	})
+	if err != nil {
+		return e, err
+	}
+	a.entries[e.Mask] = e
+	return e, nil
+}
+
+// Delete removes the entry of mask, returning false if there was none
+func (a *ACL) Delete(mask string) (bool, error) {
+	mask = NormalizeMask(mask)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.entries[mask]; !ok {
+		return false, nil
+	}
+	err := a.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(aclBucket)).Delete([]byte(mask))
+	})
+	if err != nil {
+		return false, err
+	}
+	delete(a.entries, mask)
+	return true, nil
+}
+
+// Get returns the entry of mask
+func (a *ACL) Get(mask string) (Entry, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	e, ok := a.entries[NormalizeMask(mask)]
+	return e, ok
+}
+
+// Entries returns all stored entries, highest role first
+func (a *ACL) Entries() []Entry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	entries := make([]Entry, 0, len(a.entries))
+	for _, e := range a.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Role != entries[j].Role {
+			return entries[i].Role > entries[j].Role
+		}
+		return entries[i].Mask < entries[j].Mask
+	})
+	return entries
+}
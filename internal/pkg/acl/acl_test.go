@@ -0,0 +1,162 @@
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// openDB opens a database in a temporary directory, close removes it
+func openDB(t *testing.T) (db *bolt.DB, close func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "acl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err = bolt.Open(filepath.Join(dir, "test.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCanManage(t *testing.T) {
+	tests := []struct {
+		role, target Role
+		want         bool
+	}{
+		{RoleOwner, RoleOwner, true},
+		{RoleOwner, RoleAdmin, true},
+		{RoleAdmin, RoleAdmin, false},
+		{RoleAdmin, RoleOwner, false},
+		{RoleAdmin, RoleTrusted, true},
+		{RoleAdmin, RoleIgnored, true},
+		{RoleTrusted, RoleUser, true},
+		{RoleTrusted, RoleTrusted, false},
+		{RoleUser, RoleIgnored, true},
+		{RoleUser, RoleUser, false},
+	}
+	for _, tt := range tests {
+		if got := CanManage(tt.role, tt.target); got != tt.want {
+			t.Errorf("CanManage(%s, %s) = %v, want %v", tt.role, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for role, name := range roleNames {
+		if got, err := ParseRole(name); err != nil || got != role {
+			t.Errorf("ParseRole(%q) = %v, %v", name, got, err)
+		}
+	}
+	if got, err := ParseRole("Admin"); err != nil || got != RoleAdmin {
+		t.Errorf("ParseRole is case sensitive: %v, %v", got, err)
+	}
+	if _, err := ParseRole("root"); err == nil {
+		t.Error("ParseRole of an unknown role succeeded")
+	}
+}
+
+func TestRole(t *testing.T) {
+	db, close := openDB(t)
+	defer close()
+	a, err := New(db, []string{"boss!*@*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(mask string, role Role) {
+		if _, err := a.Add(mask, role, "boss!b@host"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("*!*@trusted.example", RoleTrusted)
+	add("Admin", RoleAdmin)
+	add("$a:helper", RoleTrusted)
+	add("spammer!*@*", RoleIgnored)
+	add("*!*@spam.example", RoleIgnored)
+
+	tests := []struct {
+		hostmask, account string
+		want              Role
+	}{
+		{"boss!b@anywhere", "", RoleOwner},
+		{"admin!a@host", "", RoleAdmin},
+		{"nick!n@trusted.example", "", RoleTrusted},
+		// the highest matching role wins
+		{"admin!a@trusted.example", "", RoleAdmin},
+		{"nick!n@host", "helper", RoleTrusted},
+		{"spammer!s@host", "", RoleIgnored},
+		{"spammer!s@trusted.example", "", RoleTrusted},
+		{"nick!n@host", "", RoleUser},
+	}
+	for _, tt := range tests {
+		if got := a.Role(tt.hostmask, tt.account); got != tt.want {
+			t.Errorf("Role(%q, %q) = %s, want %s", tt.hostmask, tt.account, got, tt.want)
+		}
+	}
+
+	// entries are loaded from the database
+	a, err = New(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.Role("admin!a@host", ""); got != RoleAdmin {
+		t.Errorf("Role after reloading = %s, want admin", got)
+	}
+	if got := a.Role("boss!b@anywhere", ""); got != RoleUser {
+		t.Errorf("owners were stored: %s", got)
+	}
+	if ok, err := a.Delete("admin"); !ok || err != nil {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+	if got := a.Role("admin!a@host", ""); got != RoleUser {
+		t.Errorf("Role after deleting = %s, want user", got)
+	}
+}
+
+func TestMatchesEveryone(t *testing.T) {
+	tests := []struct {
+		mask string
+		want bool
+	}{
+		{"*", true},
+		{"*!*@*", true},
+		{"?*!*@*", true},
+		{"$a:*", true},
+		{"nick", false},
+		{"*!*@host.example", false},
+		{"$a:account", false},
+	}
+	for _, tt := range tests {
+		if got := MatchesEveryone(tt.mask); got != tt.want {
+			t.Errorf("MatchesEveryone(%q) = %v, want %v", tt.mask, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreEntryApplies(t *testing.T) {
+	tests := []struct {
+		added, role Role
+		want        bool
+	}{
+		{RoleAdmin, RoleUser, true},
+		{RoleAdmin, RoleTrusted, true},
+		{RoleAdmin, RoleAdmin, false},
+		{RoleAdmin, RoleOwner, false},
+		{RoleOwner, RoleAdmin, true},
+		{RoleTrusted, RoleTrusted, false},
+	}
+	for _, tt := range tests {
+		e := IgnoreEntry{Mask: "*!*@host", Role: tt.added}
+		if got := e.Applies(tt.role); got != tt.want {
+			t.Errorf("entry added by %s applies to %s = %v, want %v", tt.added, tt.role, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package acl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const ignoreBucket string = "Ignore"
+
+// IgnoreEntry ignores users matching Mask in every module except the
+// ones listed in Except. Role is the role of the user who added the entry,
+// the entry only applies to users it could manage.
+type IgnoreEntry struct {
+	Mask    string
+	Except  []string
+	AddedBy string
+	Role    Role
+	Added   time.Time
+}
+
+// Excepts returns true if module still listens to the ignored user
+func (e IgnoreEntry) Excepts(module string) bool {
+	for _, ex := range e.Except {
+		if strings.EqualFold(ex, module) {
+			return true
+		}
+	}
+	return false
+}
+
+// Applies returns true if the entry ignores users with role
+func (e IgnoreEntry) Applies(role Role) bool {
+	return CanManage(e.Role, role)
+}
+
+// IgnoreList stores ignored hostmasks, nicks and accounts in bbolt and
+// caches them in memory
+type IgnoreList struct {
+	db *bolt.DB
+
+	mu      sync.RWMutex
+	entries map[string]IgnoreEntry
+}
+
+// NewIgnoreList constructs an IgnoreList and loads its entries from db
+func NewIgnoreList(db *bolt.DB) (*IgnoreList, error) {
+	l := &IgnoreList{
+		db:      db,
+		entries: make(map[string]IgnoreEntry),
+	}
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(ignoreBucket))
+		if err != nil {
+			return fmt.Errorf("could not create ignore bucket: %v", err)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			// only admins could ignore users before roles were stored
+			e := IgnoreEntry{Role: RoleAdmin}
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("invalid ignore entry %s: %v", k, err)
+			}
+			l.entries[string(k)] = e
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Ignored returns true if module should ignore the user with hostmask,
+// account and role
+func (l *IgnoreList) Ignored(hostmask, account string, role Role, module string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, e := range l.entries {
+		if e.Applies(role) && Match(e.Mask, hostmask, account) && !e.Excepts(module) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add ignores mask in all modules except the ones in except for users
+// with roles lower than role
+func (l *IgnoreList) Add(mask string, except []string, addedBy string, role Role) (IgnoreEntry, error) {
+	e := IgnoreEntry{
+		Mask:    NormalizeMask(mask),
+		Except:  except,
+		AddedBy: addedBy,
+		Role:    role,
+		Added:   time.Now(),
+	}
+	enc, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err = l.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ignoreBucket)).Put([]byte(e.Mask), enc)
+	})
+	if err != nil {
+		return e, err
+	}
+	l.entries[e.Mask] = e
+	return e, nil
+}
+
+// Delete stops ignoring mask, returning false if it was not ignored
+func (l *IgnoreList) Delete(mask string) (bool, error) {
+	mask = NormalizeMask(mask)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.entries[mask]; !ok {
+		return false, nil
+	}
+	err := l.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(ignoreBucket)).Delete([]byte(mask))
+	})
+	if err != nil {
+		return false, err
+	}
+	delete(l.entries, mask)
+	return true, nil
+}
+
+// Get returns the entry of mask
+func (l *IgnoreList) Get(mask string) (IgnoreEntry, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	e, ok := l.entries[NormalizeMask(mask)]
+	return e, ok
+}
+
+// Entries returns all ignored masks sorted by mask
+func (l *IgnoreList) Entries() []IgnoreEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entries := make([]IgnoreEntry, 0, len(l.entries))
+	for _, e := range l.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Mask < entries[j].Mask
+	})
+	return entries
+}
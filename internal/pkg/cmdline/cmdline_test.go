@@ -0,0 +1,140 @@
+package cmdline
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+		err  error
+	}{
+		{"", []string{}, nil},
+		{"w  tampere\t3 ", []string{"w", "tampere", "3"}, nil},
+		{`echo "hello  world"`, []string{"echo", "hello  world"}, nil},
+		{`echo a"b c"d`, []string{"echo", "ab cd"}, nil},
+		{`echo ""`, []string{"echo", ""}, nil},
+		{`echo it's`, []string{"echo", "it's"}, nil},
+		{`echo \"quoted\"`, []string{"echo", `"quoted"`}, nil},
+		{`echo a\ b`, []string{"echo", "a b"}, nil},
+		{`echo back\\slash`, []string{"echo", `back\slash`}, nil},
+		{`echo c:\temp`, []string{"echo", `c:\temp`}, nil},
+		{`echo "say \"hi\""`, []string{"echo", `say "hi"`}, nil},
+		{`echo trailing\`, []string{"echo", `trailing\`}, nil},
+		{`echo ääkköset "öljyä ja"`, []string{"echo", "ääkköset", "öljyä ja"}, nil},
+		{`echo "unterminated`, nil, ErrUnterminatedQuote},
+		{`echo \"`, []string{"echo", `"`}, nil},
+		{`echo "\"`, nil, ErrUnterminatedQuote},
+	}
+	for _, tt := range tests {
+		got, err := Tokenize(tt.line)
+		if err != tt.err {
+			t.Errorf("Tokenize(%q) error = %v, want %v", tt.line, err, tt.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		tokens []string
+		want   string
+	}{
+		{[]string{"w", "tampere"}, "w tampere"},
+		{[]string{"w", "new york"}, `w "new york"`},
+		{[]string{"say", `a "quote"`, `back\slash`, ""}, `say "a \"quote\"" "back\\slash" ""`},
+		{[]string{"it's"}, "it's"},
+	}
+	for _, tt := range tests {
+		line := Join(tt.tokens)
+		if line != tt.want {
+			t.Errorf("Join(%q) = %s, want %s", tt.tokens, line, tt.want)
+		}
+		tokens, err := Tokenize(line)
+		if err != nil || !reflect.DeepEqual(tokens, tt.tokens) {
+			t.Errorf("Tokenize(Join(%q)) = %q, %v", tt.tokens, tokens, err)
+		}
+	}
+}
+
+func TestSpecUsage(t *testing.T) {
+	s := &Spec{
+		Args: []Arg{
+			{Name: "location"},
+			{Name: "days", Optional: true},
+			{Name: "words", Optional: true, Variadic: true},
+		},
+		Flags: []Flag{{Name: "lang", Value: "code"}, {Name: "verbose"}},
+	}
+	if got, want := s.Usage(), "<location> [days] [words...] [--lang=code] [--verbose]"; got != want {
+		t.Errorf("Usage() = %q, want %q", got, want)
+	}
+}
+
+func TestSpecParse(t *testing.T) {
+	spec := &Spec{
+		Args:  []Arg{{Name: "location"}, {Name: "days", Optional: true}},
+		Flags: []Flag{{Name: "lang", Value: "code"}, {Name: "verbose"}},
+	}
+	usage := "w <location> [days] [--lang=code] [--verbose]"
+	tests := []struct {
+		name   string
+		tokens []string
+		args   []string
+		flags  map[string]string
+		reason string
+	}{
+		{"positional", []string{"oulu", "3"}, []string{"oulu", "3"}, map[string]string{}, ""},
+		{"flag=value", []string{"--lang=fi", "oulu"}, []string{"oulu"}, map[string]string{"lang": "fi"}, ""},
+		{"empty value", []string{"oulu", "--lang="}, []string{"oulu"}, map[string]string{"lang": ""}, ""},
+		{"value with =", []string{"oulu", "--lang=a=b"}, []string{"oulu"}, map[string]string{"lang": "a=b"}, ""},
+		{"flag value", []string{"oulu", "--lang", "fi"}, []string{"oulu"}, map[string]string{"lang": "fi"}, ""},
+		{"switch", []string{"--verbose", "oulu"}, []string{"oulu"}, map[string]string{"verbose": "true"}, ""},
+		{"end of options", []string{"--", "--lang=fi"}, []string{"--lang=fi"}, map[string]string{}, ""},
+		{"value after end of options", []string{"--lang", "--", "oulu"}, []string{"oulu"}, map[string]string{"lang": "--"}, ""},
+		{"missing argument", []string{"--verbose"}, nil, nil, "missing location"},
+		{"too many", []string{"oulu", "3", "4"}, nil, nil, "too many arguments"},
+		{"unknown option", []string{"oulu", "--units=c"}, nil, nil, "unknown option --units"},
+		{"missing value", []string{"oulu", "--lang"}, nil, nil, "missing value of --lang"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, flags, err := spec.Parse("w", tt.tokens)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(args, tt.args) || !reflect.DeepEqual(flags, tt.flags) {
+					t.Errorf("Parse(%q) = %q, %q, want %q, %q", tt.tokens, args, flags, tt.args, tt.flags)
+				}
+				return
+			}
+			usageErr, ok := err.(*UsageError)
+			if !ok {
+				t.Fatalf("Parse(%q) error = %v, want a usage error", tt.tokens, err)
+			}
+			if usageErr.Reason != tt.reason || usageErr.Usage != usage {
+				t.Errorf("Parse(%q) error = %q, want %q", tt.tokens, usageErr, tt.reason+", usage: "+usage)
+			}
+		})
+	}
+}
+
+func TestSpecParseVariadic(t *testing.T) {
+	spec := &Spec{Args: []Arg{{Name: "message", Variadic: true}}}
+	args, _, err := spec.Parse("echo", []string{"one", "two", "three"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"one", "two", "three"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("Parse = %q, want %q", args, want)
+	}
+	if _, _, err := spec.Parse("echo", nil); err == nil || err.Error() != "missing message, usage: echo <message...>" {
+		t.Errorf("Parse without arguments error = %v", err)
+	}
+}
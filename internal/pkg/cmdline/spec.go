@@ -0,0 +1,129 @@
+package cmdline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Spec declares the arguments and options of a command
+type Spec struct {
+	Args  []Arg
+	Flags []Flag
+}
+
+// Arg is a positional argument. Optional arguments must come after the
+// required ones and only the last argument may be variadic.
+type Arg struct {
+	Name     string
+	Optional bool
+	// Variadic arguments take all remaining words
+	Variadic bool
+}
+
+// Flag is a --name=value or --name value option
+type Flag struct {
+	Name string
+	// Value names the value in usage, flags without one are switches
+	Value string
+}
+
+// UsageError tells what was wrong with the arguments of a command
+type UsageError struct {
+	Reason string
+	Usage  string
+}
+
+func (e *UsageError) Error() string {
+	return e.Reason + ", usage: " + e.Usage
+}
+
+// Usage returns the arguments and options of s, e.g.
+// "<location> [days] [--lang=code]"
+func (s *Spec) Usage() string {
+	parts := make([]string, 0, len(s.Args)+len(s.Flags))
+	for _, a := range s.Args {
+		name := a.Name
+		if a.Variadic {
+			name += "..."
+		}
+		if a.Optional {
+			parts = append(parts, "["+name+"]")
+			continue
+		}
+		parts = append(parts, "<"+name+">")
+	}
+	for _, f := range s.Flags {
+		if f.Value == "" {
+			parts = append(parts, "[--"+f.Name+"]")
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("[--%s=%s]", f.Name, f.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Parse splits tokens into positional arguments and flags and checks them
+// against s. Flags with a value take it after "=" or from the next token,
+// switches are set to "true" and "--" ends the options. The error is a
+// *UsageError with the usage of command.
+func (s *Spec) Parse(command string, tokens []string) ([]string, map[string]string, error) {
+	usageError := func(format string, a ...interface{}) error {
+		return &UsageError{
+			Reason: fmt.Sprintf(format, a...),
+			Usage:  strings.TrimSpace(command + " " + s.Usage()),
+		}
+	}
+	args := make([]string, 0, len(tokens))
+	flags := make(map[string]string)
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token == "--" {
+			args = append(args, tokens[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(token, "--") {
+			args = append(args, token)
+			continue
+		}
+		name, value, hasValue := splitFlag(token)
+		f, ok := s.flag(name)
+		if !ok {
+			return nil, nil, usageError("unknown option --%s", name)
+		}
+		switch {
+		case hasValue:
+		case f.Value == "":
+			value = "true"
+		case i+1 < len(tokens):
+			i++
+			value = tokens[i]
+		default:
+			return nil, nil, usageError("missing value of --%s", name)
+		}
+		flags[name] = value
+	}
+	required := 0
+	variadic := false
+	for _, a := range s.Args {
+		if !a.Optional {
+			required++
+		}
+		variadic = variadic || a.Variadic
+	}
+	if len(args) < required {
+		return nil, nil, usageError("missing %s", s.Args[len(args)].Name)
+	}
+	if len(args) > len(s.Args) && !variadic {
+		return nil, nil, usageError("too many arguments")
+	}
+	return args, flags, nil
+}
+
+func (s *Spec) flag(name string) (Flag, bool) {
+	for _, f := range s.Flags {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Flag{}, false
+}
@@ -0,0 +1,91 @@
+package cmdline
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrUnterminatedQuote is returned when a quoted argument is not closed
+var ErrUnterminatedQuote = errors.New("unterminated quote")
+
+// Tokenize splits line into arguments at whitespace. Double quotes group
+// words into one argument and a backslash escapes a double quote, a
+// backslash or whitespace. Single quotes are kept as is since they are
+// common in chat messages, e.g. "!w it's" is two arguments.
+func Tokenize(line string) ([]string, error) {
+	tokens := make([]string, 0)
+	var token strings.Builder
+	inToken := false
+	quoted := false
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			if r != '"' && r != '\\' && r != ' ' && r != '\t' {
+				token.WriteRune('\\')
+			}
+			token.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+			inToken = true
+		case r == '"':
+			quoted = !quoted
+			inToken = true
+		case (r == ' ' || r == '\t') && !quoted:
+			if inToken {
+				tokens = append(tokens, token.String())
+				token.Reset()
+				inToken = false
+			}
+		default:
+			token.WriteRune(r)
+			inToken = true
+		}
+	}
+	if quoted {
+		return nil, ErrUnterminatedQuote
+	}
+	if escaped {
+		token.WriteRune('\\')
+	}
+	if inToken {
+		tokens = append(tokens, token.String())
+	}
+	return tokens, nil
+}
+
+// Join joins tokens into a line Tokenize splits into the same tokens,
+// tokens that are empty or contain whitespace, quotes or backslashes
+// are quoted
+func Join(tokens []string) string {
+	var line strings.Builder
+	for i, token := range tokens {
+		if i > 0 {
+			line.WriteByte(' ')
+		}
+		if token != "" && !strings.ContainsAny(token, " \t\"\\") {
+			line.WriteString(token)
+			continue
+		}
+		line.WriteByte('"')
+		for _, r := range token {
+			if r == '"' || r == '\\' {
+				line.WriteByte('\\')
+			}
+			line.WriteRune(r)
+		}
+		line.WriteByte('"')
+	}
+	return line.String()
+}
+
+// splitFlag returns the name and value of a --name=value token and whether
+// it had a value
+func splitFlag(token string) (string, string, bool) {
+	name := token[2:]
+	if eq := strings.IndexByte(name, '='); eq >= 0 {
+		return name[:eq], name[eq+1:], true
+	}
+	return name, "", false
+}
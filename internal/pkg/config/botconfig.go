@@ -3,10 +3,158 @@ package config
 import (
 	"encoding/json"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 
 	"github.com/huqa/gofibot/internal/pkg/logger"
 )
 
+const (
+	defaultPort    int = 6667
+	defaultTLSPort int = 6697
+
+	defaultReconnectInitialDelay int     = 5
+	defaultReconnectMaxDelay     int     = 300
+	defaultReconnectMultiplier   float64 = 2
+	defaultReconnectJitter       float64 = 0.2
+
+	defaultFloodRate        float64 = 0.5
+	defaultFloodBurst       int     = 4
+	defaultFloodGlobalRate  float64 = 1
+	defaultFloodGlobalBurst int     = 6
+	defaultFloodMaxLines    int     = 5
+	defaultFloodQueueSize   int     = 200
+
+	defaultModuleTimeout   int = 30
+	defaultBreakerFailures int = 5
+	defaultBreakerWindow   int = 300
+	defaultBreakerCooldown int = 600
+	defaultWorkers         int = 4
+	defaultWorkerQueueSize int = 100
+
+	defaultDatabaseDir string = "db"
+	defaultBackupDir   string = "backups"
+	defaultBackupKeep  int    = 7
+
+	defaultNickServ        string = "NickServ"
+	defaultNickServTimeout int    = 15
+
+	maskedSecret string = "********"
+)
+
+// environment variables that override credentials from the config file
+const (
+	envSASLUser         string = "GOFIBOT_SASL_USER"
+	envSASLPassword     string = "GOFIBOT_SASL_PASSWORD"
+	envNickServAccount  string = "GOFIBOT_NICKSERV_ACCOUNT"
+	envNickServPassword string = "GOFIBOT_NICKSERV_PASSWORD"
+)
+
+// SASL mechanisms supported by the bot
+const (
+	SASLPlain    string = "PLAIN"
+	SASLExternal string = "EXTERNAL"
+)
+
+// SASLConfiguration defines SASL authentication done during registration
+type SASLConfiguration struct {
+	Mechanism string `json:"mechanism"`
+	User      string `json:"user"`
+	Password  string `json:"password"`
+}
+
+// NickServConfiguration defines NickServ IDENTIFY done after registration
+type NickServConfiguration struct {
+	Service  string `json:"service"`
+	Account  string `json:"account"`
+	Password string `json:"password"`
+	// Timeout in seconds to wait for NickServ before joining channels anyway
+	Timeout int `json:"timeout"`
+}
+
+// ReconnectConfiguration defines how the bot reconnects after losing
+// the connection. Delays are in seconds, MaxAttempts 0 retries forever.
+type ReconnectConfiguration struct {
+	InitialDelay int     `json:"initialDelay"`
+	MaxDelay     int     `json:"maxDelay"`
+	Multiplier   float64 `json:"multiplier"`
+	Jitter       float64 `json:"jitter"`
+	MaxAttempts  int     `json:"maxAttempts"`
+}
+
+// FloodConfiguration defines outgoing message limits. Rates are messages
+// per second, LineLength 0 calculates the longest line that fits in an
+// irc message.
+type FloodConfiguration struct {
+	Rate        float64 `json:"rate"`
+	Burst       int     `json:"burst"`
+	GlobalRate  float64 `json:"globalRate"`
+	GlobalBurst int     `json:"globalBurst"`
+	MaxLines    int     `json:"maxLines"`
+	LineLength  int     `json:"lineLength"`
+	QueueSize   int     `json:"queueSize"`
+}
+
+// RateLimitConfiguration defines command rate limits. Commands overrides
+// module cooldowns per command in seconds, ChannelRate and ChannelBurst
+// limit commands per second on a channel and Notice tells users when
+// they are on cooldown.
+type RateLimitConfiguration struct {
+	Commands     map[string]int `json:"commands"`
+	ChannelRate  float64        `json:"channelRate"`
+	ChannelBurst int            `json:"channelBurst"`
+	Notice       bool           `json:"notice"`
+}
+
+// PermissionConfiguration defines the minimum roles needed to run
+// commands, keyed by module name or command. Command entries override
+// module entries.
+type PermissionConfiguration struct {
+	Modules  map[string]string `json:"modules"`
+	Commands map[string]string `json:"commands"`
+}
+
+// ExecutionConfiguration defines how modules are run. Timeout limits a
+// single run in seconds, 0 is unlimited. A module failing BreakerFailures times within
+// BreakerWindow seconds is disabled for BreakerCooldown seconds and the
+// nicks or channels in Notify are told about it. BreakerFailures 0
+// never disables modules. Events are handled by Workers workers with
+// queues of QueueSize events, events of a channel are handled in order.
+type ExecutionConfiguration struct {
+	Timeout         int      `json:"timeout"`
+	BreakerFailures int      `json:"breakerFailures"`
+	BreakerWindow   int      `json:"breakerWindow"`
+	BreakerCooldown int      `json:"breakerCooldown"`
+	Notify          []string `json:"notify"`
+	Workers         int      `json:"workers"`
+	QueueSize       int      `json:"queueSize"`
+}
+
+// ScheduleConfiguration overrides the cron expression and the channels
+// of a scheduled job, "*" in Channels means every channel of the bot
+type ScheduleConfiguration struct {
+	Spec     string   `json:"spec"`
+	Channels []string `json:"channels"`
+}
+
+// DatabaseConfiguration defines where the database is and how it is
+// backed up. Path defaults to databaseFile in the db directory. A hot
+// backup is written to BackupDir on the cron schedule BackupSpec, the
+// newest BackupKeep backups are kept and 0 keeps all of them.
+type DatabaseConfiguration struct {
+	Path       string `json:"path"`
+	BackupDir  string `json:"backupDir"`
+	BackupSpec string `json:"backupSpec"`
+	BackupKeep int    `json:"backupKeep"`
+}
+
+// ChannelModulesConfiguration limits which modules run on a channel. If
+// Allow is not empty only the listed modules run, modules in Deny never run.
+type ChannelModulesConfiguration struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
 type BotConfiguration struct {
 	Nick         string   `json:"nick"`
 	Ident        string   `json:"ident"`
@@ -14,13 +162,41 @@ type BotConfiguration struct {
 	Version      string   `json:"version"`
 	QuitMessage  string   `json:"quitMessage"`
 	Server       string   `json:"server"`
+	Servers      []string `json:"servers"`
+	Port         int      `json:"port"`
+	TLS          bool     `json:"tls"`
+	TLSVerify    bool     `json:"tlsVerify"`
+	TLSCert      string   `json:"tlsCert"`
+	TLSKey       string   `json:"tlsKey"`
 	Channels     []string `json:"channels"`
 	Prefix       string   `json:"prefix"`
 	DatabaseFile string   `json:"databaseFile"`
 	Location     string   `json:"location"`
+	Owners       []string `json:"owners"`
+
+	SASL        SASLConfiguration       `json:"sasl"`
+	NickServ    NickServConfiguration   `json:"nickserv"`
+	Reconnect   ReconnectConfiguration  `json:"reconnect"`
+	Flood       FloodConfiguration      `json:"flood"`
+	RateLimit   RateLimitConfiguration  `json:"rateLimit"`
+	Permissions PermissionConfiguration `json:"permissions"`
+	Execution   ExecutionConfiguration  `json:"execution"`
+	Database    DatabaseConfiguration   `json:"database"`
+
+	ChannelModules map[string]ChannelModulesConfiguration `json:"channelModules"`
+	// Prefixes replace Prefix on the listed channels
+	Prefixes map[string][]string `json:"prefixes"`
+	// Schedules are keyed by module and job name, e.g. "stats/daily"
+	Schedules map[string]ScheduleConfiguration `json:"schedules"`
 }
 
 func (c BotConfiguration) String() string {
+	if c.SASL.Password != "" {
+		c.SASL.Password = maskedSecret
+	}
+	if c.NickServ.Password != "" {
+		c.NickServ.Password = maskedSecret
+	}
 	return toJSON(c)
 }
 
@@ -33,12 +209,98 @@ func toJSON(c interface{}) string {
 	return string(bytes)
 }
 
-func LoadBotConfiguration(filePath string) (BotConfiguration, error) {
+// Overrides are settings given on the command line. They replace the
+// settings of the configuration file before defaults derived from them
+// are applied.
+type Overrides struct {
+	DatabasePath string
+}
+
+// apply replaces the settings of config that are set in o
+func (o Overrides) apply(config *BotConfiguration) {
+	if o.DatabasePath != "" {
+		config.Database.Path = o.DatabasePath
+	}
+}
+
+func LoadBotConfiguration(filePath string, overrides Overrides) (BotConfiguration, error) {
 	raw, err := ioutil.ReadFile(filePath)
 	if err != nil {
 		return BotConfiguration{}, err
 	}
-	var config BotConfiguration
+	// certificates are verified unless explicitly disabled
+	config := BotConfiguration{
+		TLSVerify: true,
+		Reconnect: ReconnectConfiguration{
+			InitialDelay: defaultReconnectInitialDelay,
+			MaxDelay:     defaultReconnectMaxDelay,
+			Multiplier:   defaultReconnectMultiplier,
+			Jitter:       defaultReconnectJitter,
+		},
+		Flood: DefaultFloodConfiguration(),
+		Execution: ExecutionConfiguration{
+			Timeout:         defaultModuleTimeout,
+			BreakerFailures: defaultBreakerFailures,
+			BreakerWindow:   defaultBreakerWindow,
+			BreakerCooldown: defaultBreakerCooldown,
+			Workers:         defaultWorkers,
+			QueueSize:       defaultWorkerQueueSize,
+		},
+		Database: DatabaseConfiguration{
+			BackupKeep: defaultBackupKeep,
+		},
+	}
 	err = json.Unmarshal(raw, &config)
-	return config, err
+	if err != nil {
+		return config, err
+	}
+	applyEnvironment(&config)
+	overrides.apply(&config)
+	if config.NickServ.Service == "" {
+		config.NickServ.Service = defaultNickServ
+	}
+	if config.NickServ.Timeout <= 0 {
+		config.NickServ.Timeout = defaultNickServTimeout
+	}
+	if config.Database.Path == "" {
+		config.Database.Path = filepath.Join(defaultDatabaseDir, config.DatabaseFile)
+	}
+	if config.Database.BackupDir == "" {
+		config.Database.BackupDir = filepath.Join(filepath.Dir(config.Database.Path), defaultBackupDir)
+	}
+	if config.Port == 0 {
+		config.Port = defaultPort
+		if config.TLS {
+			config.Port = defaultTLSPort
+		}
+	}
+	return config, nil
+}
+
+// DefaultFloodConfiguration returns the default outgoing message limits
+func DefaultFloodConfiguration() FloodConfiguration {
+	return FloodConfiguration{
+		Rate:        defaultFloodRate,
+		Burst:       defaultFloodBurst,
+		GlobalRate:  defaultFloodGlobalRate,
+		GlobalBurst: defaultFloodGlobalBurst,
+		MaxLines:    defaultFloodMaxLines,
+		QueueSize:   defaultFloodQueueSize,
+	}
+}
+
+// applyEnvironment overrides credentials with environment variables if set
+func applyEnvironment(config *BotConfiguration) {
+	if v, ok := os.LookupEnv(envSASLUser); ok {
+		config.SASL.User = v
+	}
+	if v, ok := os.LookupEnv(envSASLPassword); ok {
+		config.SASL.Password = v
+	}
+	if v, ok := os.LookupEnv(envNickServAccount); ok {
+		config.NickServ.Account = v
+	}
+	if v, ok := os.LookupEnv(envNickServPassword); ok {
+		config.NickServ.Password = v
+	}
 }
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadDatabaseOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bot-config.json")
+	if err := ioutil.WriteFile(path, []byte(`{"databaseFile": "bot.db"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		overrides            Overrides
+		wantPath, wantBackup string
+	}{
+		{Overrides{}, filepath.Join("db", "bot.db"), filepath.Join("db", "backups")},
+		{Overrides{DatabasePath: "/var/lib/gofibot/test.db"}, "/var/lib/gofibot/test.db", "/var/lib/gofibot/backups"},
+	}
+	for _, tt := range tests {
+		cfg, err := LoadBotConfiguration(path, tt.overrides)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Database.Path != tt.wantPath || cfg.Database.BackupDir != tt.wantBackup {
+			t.Errorf("with %+v database is %s backed up to %s, want %s and %s", tt.overrides, cfg.Database.Path, cfg.Database.BackupDir, tt.wantPath, tt.wantBackup)
+		}
+	}
+}
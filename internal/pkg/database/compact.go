@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Compact rewrites the database at path without free pages and returns
+// its size before and after. The database must not be in use.
+func Compact(path string) (before, after int64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("can't compact: %v", err)
+	}
+	before = info.Size()
+
+	src, err := Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer src.Close()
+
+	tmp := path + ".compact"
+	os.Remove(tmp)
+	dst, err := Open(tmp)
+	if err != nil {
+		return 0, 0, err
+	}
+	err = src.View(func(srcTx *bolt.Tx) error {
+		return dst.Update(func(dstTx *bolt.Tx) error {
+			return srcTx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				copied, err := dstTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+				return copyBucket(copied, b)
+			})
+		})
+	})
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, 0, fmt.Errorf("can't compact: %v", err)
+	}
+
+	src.Close()
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, 0, fmt.Errorf("can't replace database: %v", err)
+	}
+	info, err = os.Stat(path)
+	if err != nil {
+		return before, 0, err
+	}
+	return before, info.Size(), nil
+}
+
+// copyBucket copies the values and nested buckets of src to dst
+func copyBucket(dst, src *bolt.Bucket) error {
+	// values are written in order, full pages keep the copy small
+	dst.FillPercent = 1
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		nested, err := dst.CreateBucket(k)
+		if err != nil {
+			return err
+		}
+		return copyBucket(nested, src.Bucket(k))
+	})
+}
@@ -0,0 +1,142 @@
+// Package database opens, backs up, exports and inspects the bbolt
+// database of the bot
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	openTimeout      time.Duration = 1 * time.Second
+	backupTimeFormat string        = "20060102-150405"
+	// manualPrefix keeps manual backups out of Backups so they are
+	// never removed
+	manualPrefix string = "manual-"
+)
+
+// Open opens the database at path, creating it and its directory if
+// needed
+func Open(path string) (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("can't create database directory: %v", err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("can't open database %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// OpenReadOnly opens the existing database at path for reading
+func OpenReadOnly(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("can't open database %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// Backup writes a consistent copy of db to path while db stays in use
+func Backup(db *bolt.DB, path string) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("can't create backup: %v", err)
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(f)
+		return err
+	})
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("can't write backup: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("can't write backup: %v", err)
+	}
+	return nil
+}
+
+// BackupTo writes a timestamped backup of db to dir and removes all but
+// the newest keep backups, keep 0 keeps every backup. It returns the
+// path of the backup.
+func BackupTo(db *bolt.DB, dir string, keep int) (string, error) {
+	path, err := backupStamped(db, dir, backupPrefix(db.Path()))
+	if err != nil {
+		return "", err
+	}
+	if keep <= 0 {
+		return path, nil
+	}
+	backups, err := Backups(db.Path(), dir)
+	if err != nil {
+		return path, err
+	}
+	for len(backups) > keep {
+		if err := os.Remove(backups[0]); err != nil {
+			return path, fmt.Errorf("can't remove old backup: %v", err)
+		}
+		backups = backups[1:]
+	}
+	return path, nil
+}
+
+// ManualBackupTo writes a timestamped backup of db to dir that is not
+// one of its Backups and so is never removed. It returns the path of the
+// backup.
+func ManualBackupTo(db *bolt.DB, dir string) (string, error) {
+	return backupStamped(db, dir, backupPrefix(db.Path())+manualPrefix)
+}
+
+// backupStamped writes a backup of db to dir named prefix followed by
+// the time
+func backupStamped(db *bolt.DB, dir, prefix string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("can't create backup directory: %v", err)
+	}
+	path := filepath.Join(dir, prefix+time.Now().Format(backupTimeFormat)+".db")
+	if err := Backup(db, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Backups returns the backups of the database at dbPath in dir, oldest
+// first
+func Backups(dbPath, dir string) ([]string, error) {
+	prefix := backupPrefix(dbPath)
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"*.db"))
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]string, 0, len(files))
+	for _, f := range files {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(f), prefix), ".db")
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, f)
+		}
+	}
+	// timestamps sort in time order
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// backupPrefix returns the start of backup file names of dbPath
+func backupPrefix(dbPath string) string {
+	base := filepath.Base(dbPath)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// testData has json, text, binary and empty values in nested buckets,
+// some of which have binary names
+var testData = map[string]map[string][]byte{
+	"Guess/Rolls":                {"\x00\x00\x00\x00\x00\x00\x00\x28": []byte(`{"Value":40}`)},
+	"Guess/Stats":                {"nick": []byte(`{"Nick":"nick","Guesses":1}`)},
+	"Guess/\x00\x00\x00\x2a\xff": {"nick": []byte("1")},
+	"\xfe\xff":                   {"key": []byte("value")},
+	"Schedule":                   {"stats/daily": []byte("2026-10-18T00:00:00Z"), "null": []byte("null")},
+	"Binary":                     {"key": {0xff, 0x00, 0xfe}, "empty": {}, "spaced": []byte(`{"a": 1}`)},
+}
+
+func testDB(t *testing.T, dir, name string) *bolt.DB {
+	t.Helper()
+	db, err := Open(filepath.Join(dir, "db", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func fill(t *testing.T, db *bolt.DB) {
+	t.Helper()
+	err := db.Update(func(tx *bolt.Tx) error {
+		for path, values := range testData {
+			names := strings.Split(path, "/")
+			b, err := tx.CreateBucketIfNotExists([]byte(names[0]))
+			if err != nil {
+				return err
+			}
+			for _, name := range names[1:] {
+				if b, err = b.CreateBucketIfNotExists([]byte(name)); err != nil {
+					return err
+				}
+			}
+			for k, v := range values {
+				if err := b.Put([]byte(k), v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// contents returns every value of db by bucket path
+func contents(t *testing.T, db *bolt.DB) map[string]map[string][]byte {
+	t.Helper()
+	data := make(map[string]map[string][]byte)
+	var walk func(path string, b *bolt.Bucket)
+	walk = func(path string, b *bolt.Bucket) {
+		b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				walk(path+"/"+string(k), b.Bucket(k))
+				return nil
+			}
+			if data[path] == nil {
+				data[path] = make(map[string][]byte)
+			}
+			data[path][string(k)] = append([]byte{}, v...)
+			return nil
+		})
+	}
+	db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			walk(string(name), b)
+			return nil
+		})
+	})
+	return data
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "database")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestExportImport(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	src := testDB(t, dir, "src.db")
+	defer src.Close()
+	fill(t, src)
+
+	var export bytes.Buffer
+	if err := Export(src, &export); err != nil {
+		t.Fatal(err)
+	}
+	dst := testDB(t, dir, "dst.db")
+	defer dst.Close()
+	if err := Import(dst, bytes.NewReader(export.Bytes()), false); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := contents(t, dst), contents(t, src); !reflect.DeepEqual(got, want) {
+		t.Errorf("imported %q, want %q", got, want)
+	}
+
+	// replace empties the buckets before importing
+	dst.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("Schedule")).Put([]byte("extra"), []byte("x"))
+	})
+	if err := Import(dst, bytes.NewReader(export.Bytes()), true); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := contents(t, dst), contents(t, src); !reflect.DeepEqual(got, want) {
+		t.Errorf("replaced %q, want %q", got, want)
+	}
+}
+
+func TestBackupTo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := testDB(t, dir, "bot.db")
+	defer db.Close()
+	fill(t, db)
+
+	backupDir := filepath.Join(dir, "backups")
+	// older backups and unrelated files
+	os.MkdirAll(backupDir, 0700)
+	for _, name := range []string{"bot-20200101-000000.db", "bot-20200102-000000.db", "bot-notes.db", "other-20200101-000000.db"} {
+		ioutil.WriteFile(filepath.Join(backupDir, name), nil, 0600)
+	}
+
+	path, err := BackupTo(db, backupDir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backups, err := Backups(db.Path(), backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(backupDir, "bot-20200102-000000.db"), path}
+	if !reflect.DeepEqual(backups, want) {
+		t.Errorf("kept %v, want %v", backups, want)
+	}
+	for _, name := range []string{"bot-notes.db", "other-20200101-000000.db"} {
+		if _, err := os.Stat(filepath.Join(backupDir, name)); err != nil {
+			t.Errorf("removed unrelated file %s", name)
+		}
+	}
+
+	backup, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	if got, want := contents(t, backup), contents(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("backed up %q, want %q", got, want)
+	}
+}
+
+func TestManualBackupTo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := testDB(t, dir, "bot.db")
+	defer db.Close()
+	fill(t, db)
+
+	backupDir := filepath.Join(dir, "backups")
+	manual, err := ManualBackupTo(db, backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BackupTo(db, backupDir, 1); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := Backups(db.Path(), backupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range backups {
+		if b == manual {
+			t.Errorf("manual backup %s is listed for removal", manual)
+		}
+	}
+	if _, err := os.Stat(manual); err != nil {
+		t.Errorf("manual backup was removed: %v", err)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := testDB(t, dir, "bot.db")
+	fill(t, db)
+	// leave free pages behind
+	db.Update(func(tx *bolt.Tx) error {
+		b, _ := tx.CreateBucket([]byte("Garbage"))
+		for i := 0; i < 1000; i++ {
+			b.Put([]byte(strings.Repeat("k", 10)+string(rune(i))), bytes.Repeat([]byte("v"), 100))
+		}
+		return nil
+	})
+	db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte("Garbage"))
+	})
+	want := contents(t, db)
+	path := db.Path()
+	db.Close()
+
+	before, after, err := Compact(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after >= before {
+		t.Errorf("compacted from %d to %d bytes", before, after)
+	}
+	db, err = OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if got := contents(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("compacted %q, want %q", got, want)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	db := testDB(t, dir, "bot.db")
+	defer db.Close()
+	fill(t, db)
+
+	var out bytes.Buffer
+	if err := Inspect(db, []string{"Guess"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "0x0000002aff/ (1 keys)\nRolls/ (1 keys)\nStats/ (1 keys)\n"; out.String() != want {
+		t.Errorf("Inspect Guess = %q, want %q", out.String(), want)
+	}
+	out.Reset()
+	if err := Inspect(db, []string{"Guess", "Rolls"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := "0x0000000000000028 = {\"Value\":40}\n"; out.String() != want {
+		t.Errorf("Inspect Guess Rolls = %q, want %q", out.String(), want)
+	}
+	if err := Inspect(db, []string{"Missing"}, &out); err == nil {
+		t.Error("inspected a missing bucket")
+	}
+}
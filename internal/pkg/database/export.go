@@ -0,0 +1,181 @@
+package database
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket is an exported bucket with its values and nested buckets. Names
+// that are not printable text are in NameBase64 like the keys of entries.
+type Bucket struct {
+	Name       string   `json:"name,omitempty"`
+	NameBase64 []byte   `json:"nameBase64,omitempty"`
+	Entries    []Entry  `json:"entries,omitempty"`
+	Buckets    []Bucket `json:"buckets,omitempty"`
+}
+
+// Entry is an exported key and value. Keys that are not printable text
+// are in KeyBase64. Values are kept as json if they are json, as text
+// if they are text and otherwise in Base64.
+type Entry struct {
+	Key       string          `json:"key,omitempty"`
+	KeyBase64 []byte          `json:"keyBase64,omitempty"`
+	JSON      json.RawMessage `json:"json,omitempty"`
+	Text      string          `json:"text,omitempty"`
+	Base64    []byte          `json:"base64,omitempty"`
+}
+
+// newEntry exports k and v
+func newEntry(k, v []byte) Entry {
+	var e Entry
+	if isPrintable(k) {
+		e.Key = string(k)
+	} else {
+		e.KeyBase64 = append([]byte{}, k...)
+	}
+	switch {
+	case isCompactJSON(v):
+		e.JSON = append(json.RawMessage{}, v...)
+	case utf8.Valid(v):
+		e.Text = string(v)
+	default:
+		e.Base64 = append([]byte{}, v...)
+	}
+	return e
+}
+
+// key returns the key of e
+func (e Entry) key() []byte {
+	if e.KeyBase64 != nil {
+		return e.KeyBase64
+	}
+	return []byte(e.Key)
+}
+
+// name returns the name of b
+func (b Bucket) name() []byte {
+	if b.NameBase64 != nil {
+		return b.NameBase64
+	}
+	return []byte(b.Name)
+}
+
+// value returns the value of e
+func (e Entry) value() ([]byte, error) {
+	switch {
+	case e.JSON != nil:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, e.JSON); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case e.Base64 != nil:
+		return e.Base64, nil
+	default:
+		return []byte(e.Text), nil
+	}
+}
+
+// isCompactJSON returns true if v is json that survives a round trip
+// through an indented export unchanged
+func isCompactJSON(v []byte) bool {
+	if len(v) == 0 || !json.Valid(v) {
+		return false
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, v); err != nil {
+		return false
+	}
+	return bytes.Equal(buf.Bytes(), v)
+}
+
+// Export writes every bucket of db to w as indented json
+func Export(db *bolt.DB, w io.Writer) error {
+	buckets := make([]Bucket, 0)
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			buckets = append(buckets, exportBucket(name, b))
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("can't read database: %v", err)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(buckets)
+}
+
+func exportBucket(name []byte, b *bolt.Bucket) Bucket {
+	var exported Bucket
+	if isPrintable(name) {
+		exported.Name = string(name)
+	} else {
+		exported.NameBase64 = append([]byte{}, name...)
+	}
+	b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			exported.Buckets = append(exported.Buckets, exportBucket(k, b.Bucket(k)))
+			return nil
+		}
+		exported.Entries = append(exported.Entries, newEntry(k, v))
+		return nil
+	})
+	return exported
+}
+
+// Import writes the buckets exported to r into db in one transaction.
+// Existing values are overwritten, with replace the top level buckets in
+// r are emptied first.
+func Import(db *bolt.DB, r io.Reader, replace bool) error {
+	var buckets []Bucket
+	if err := json.NewDecoder(r).Decode(&buckets); err != nil {
+		return fmt.Errorf("can't read export: %v", err)
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, exported := range buckets {
+			name := exported.name()
+			if replace {
+				if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+					return fmt.Errorf("can't replace bucket %s: %v", printable(name), err)
+				}
+			}
+			b, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return fmt.Errorf("can't create bucket %s: %v", printable(name), err)
+			}
+			if err := importBucket(b, exported); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func importBucket(b *bolt.Bucket, exported Bucket) error {
+	name := printable(exported.name())
+	for _, e := range exported.Entries {
+		v, err := e.value()
+		if err != nil {
+			return fmt.Errorf("invalid value of %s in %s: %v", printable(e.key()), name, err)
+		}
+		if err := b.Put(e.key(), v); err != nil {
+			return fmt.Errorf("can't import %s in %s: %v", printable(e.key()), name, err)
+		}
+	}
+	for _, nested := range exported.Buckets {
+		child, err := b.CreateBucketIfNotExists(nested.name())
+		if err != nil {
+			return fmt.Errorf("can't create bucket %s: %v", printable(nested.name()), err)
+		}
+		if err := importBucket(child, nested); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Inspect writes the values and nested buckets of the bucket at path to
+// w, without a path it lists the top level buckets
+func Inspect(db *bolt.DB, path []string, w io.Writer) error {
+	return db.View(func(tx *bolt.Tx) error {
+		if len(path) == 0 {
+			return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				_, err := fmt.Fprintf(w, "%s/ (%d keys)\n", printable(name), b.Stats().KeyN)
+				return err
+			})
+		}
+		b := tx.Bucket([]byte(path[0]))
+		for _, name := range path[1:] {
+			if b == nil {
+				break
+			}
+			b = b.Bucket([]byte(name))
+		}
+		if b == nil {
+			return fmt.Errorf("no bucket %s", strings.Join(path, "/"))
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var err error
+			if v == nil {
+				_, err = fmt.Fprintf(w, "%s/ (%d keys)\n", printable(k), b.Bucket(k).Stats().KeyN)
+			} else {
+				_, err = fmt.Fprintf(w, "%s = %s\n", printable(k), printable(v))
+			}
+			return err
+		})
+	})
+}
+
+// printable returns b as text if it is printable and in hex otherwise
+func printable(b []byte) string {
+	if !isPrintable(b) {
+		return fmt.Sprintf("0x%x", b)
+	}
+	return string(b)
+}
+
+// isPrintable returns true if b is text without control characters
+func isPrintable(b []byte) bool {
+	if !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
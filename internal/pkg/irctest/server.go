@@ -0,0 +1,324 @@
+// Package irctest implements a fake IRC server for end-to-end tests of
+// the bot
+package irctest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lrstanley/girc"
+)
+
+const serverName string = "irctest"
+
+// ErrTimeout is returned when the expected output did not arrive in time
+var ErrTimeout = errors.New("timed out waiting for the client")
+
+// Server is a fake IRC server listening on localhost. It accepts one
+// client at a time, completes its registration, echoes joins, parts and
+// nick changes and records every line the client sends.
+type Server struct {
+	listener net.Listener
+
+	mu         sync.Mutex
+	conn       net.Conn
+	nick       string
+	user       string
+	registered bool
+	channels   map[string]bool
+	received   []*girc.Event
+	// cursor is the index of the first event not yet returned by Expect
+	cursor int
+	// updated is closed and replaced whenever the state above changes
+	updated chan struct{}
+	closed  bool
+}
+
+// NewServer starts a Server on a random localhost port
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("can't listen: %v", err)
+	}
+	s := &Server{
+		listener: listener,
+		channels: make(map[string]bool),
+		updated:  make(chan struct{}),
+	}
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the host and port the server listens on
+func (s *Server) Addr() (string, int) {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+// Close stops the server and drops the client
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.notify()
+	s.mu.Unlock()
+	return s.listener.Close()
+}
+
+// Nick returns the current nick of the client
+func (s *Server) Nick() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nick
+}
+
+// Received returns every event the client has sent
+func (s *Server) Received() []*girc.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := make([]*girc.Event, len(s.received))
+	copy(events, s.received)
+	return events
+}
+
+// Send sends a raw line to the client
+func (s *Server) Send(format string, args ...interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.send(fmt.Sprintf(format, args...))
+}
+
+// Privmsg sends message to target as if from was sending it. A plain
+// nick in from is expanded to a hostmask.
+func (s *Server) Privmsg(from, target, message string) error {
+	return s.Send(":%s PRIVMSG %s :%s", hostmask(from), target, message)
+}
+
+// WaitRegistered waits until the client has registered
+func (s *Server) WaitRegistered(timeout time.Duration) error {
+	return s.wait(timeout, func() bool {
+		return s.registered
+	})
+}
+
+// WaitJoined waits until the client has joined channel
+func (s *Server) WaitJoined(channel string, timeout time.Duration) error {
+	channel = girc.ToRFC1459(channel)
+	return s.wait(timeout, func() bool {
+		return s.channels[channel]
+	})
+}
+
+// Joined returns true if the client is on channel
+func (s *Server) Joined(channel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.channels[girc.ToRFC1459(channel)]
+}
+
+// Expect returns the next event sent by the client that match accepts.
+// Events before it are skipped and not returned again.
+func (s *Server) Expect(timeout time.Duration, match func(e *girc.Event) bool) (*girc.Event, error) {
+	var found *girc.Event
+	err := s.wait(timeout, func() bool {
+		for i := s.cursor; i < len(s.received); i++ {
+			if match(s.received[i]) {
+				found = s.received[i]
+				s.cursor = i + 1
+				return true
+			}
+		}
+		return false
+	})
+	return found, err
+}
+
+// ExpectMessage returns the text of the next PRIVMSG or NOTICE sent to
+// target
+func (s *Server) ExpectMessage(target string, timeout time.Duration) (string, error) {
+	e, err := s.Expect(timeout, IsMessageTo(target))
+	if err != nil {
+		return "", fmt.Errorf("no message to %s: %v", target, err)
+	}
+	return e.Last(), nil
+}
+
+// ExpectNoMessage returns an error if a PRIVMSG or NOTICE is sent to
+// target within wait
+func (s *Server) ExpectNoMessage(target string, wait time.Duration) error {
+	e, err := s.Expect(wait, IsMessageTo(target))
+	if err == ErrTimeout {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected message to %s: %s", target, e.Last())
+}
+
+// IsMessageTo matches PRIVMSGs and NOTICEs sent to target
+func IsMessageTo(target string) func(e *girc.Event) bool {
+	target = girc.ToRFC1459(target)
+	return func(e *girc.Event) bool {
+		if e.Command != girc.PRIVMSG && e.Command != girc.NOTICE {
+			return false
+		}
+		return len(e.Params) > 0 && girc.ToRFC1459(e.Params[0]) == target
+	}
+}
+
+// wait waits until done returns true, done is called with mu held
+func (s *Server) wait(timeout time.Duration, done func() bool) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		ok := done()
+		closed := s.closed
+		updated := s.updated
+		s.mu.Unlock()
+		if ok {
+			return nil
+		}
+		if closed {
+			return errors.New("server closed")
+		}
+		select {
+		case <-updated:
+		case <-deadline.C:
+			return ErrTimeout
+		}
+	}
+}
+
+// notify wakes up waiters, it is called with mu held
+func (s *Server) notify() {
+	close(s.updated)
+	s.updated = make(chan struct{})
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.conn = conn
+		s.registered = false
+		s.channels = make(map[string]bool)
+		s.mu.Unlock()
+		go s.read(conn)
+	}
+}
+
+func (s *Server) read(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		e := girc.ParseEvent(scanner.Text())
+		if e == nil {
+			continue
+		}
+		s.mu.Lock()
+		if s.conn != conn {
+			s.mu.Unlock()
+			return
+		}
+		s.received = append(s.received, e)
+		s.handle(e)
+		s.notify()
+		s.mu.Unlock()
+		if e.Command == girc.QUIT {
+			return
+		}
+	}
+}
+
+// handle answers the commands a client needs answered, it is called
+// with mu held
+func (s *Server) handle(e *girc.Event) {
+	switch e.Command {
+	case girc.CAP:
+		if len(e.Params) > 0 && e.Params[0] == girc.CAP_LS {
+			s.send(fmt.Sprintf(":%s CAP * LS :", serverName))
+		}
+	case girc.PING:
+		s.send(fmt.Sprintf(":%s PONG %s :%s", serverName, serverName, e.Last()))
+	case girc.NICK:
+		if len(e.Params) == 0 {
+			return
+		}
+		if s.registered {
+			s.send(fmt.Sprintf(":%s NICK %s", s.hostmask(), e.Params[0]))
+		}
+		s.nick = e.Params[0]
+		s.register()
+	case girc.USER:
+		if len(e.Params) == 0 {
+			return
+		}
+		s.user = e.Params[0]
+		s.register()
+	case girc.JOIN:
+		if len(e.Params) == 0 {
+			return
+		}
+		for _, ch := range strings.Split(e.Params[0], ",") {
+			s.channels[girc.ToRFC1459(ch)] = true
+			s.send(fmt.Sprintf(":%s JOIN %s", s.hostmask(), ch))
+			s.send(fmt.Sprintf(":%s 353 %s = %s :%s", serverName, s.nick, ch, s.nick))
+			s.send(fmt.Sprintf(":%s 366 %s %s :End of /NAMES list.", serverName, s.nick, ch))
+		}
+	case girc.PART:
+		if len(e.Params) == 0 {
+			return
+		}
+		for _, ch := range strings.Split(e.Params[0], ",") {
+			delete(s.channels, girc.ToRFC1459(ch))
+			s.send(fmt.Sprintf(":%s PART %s", s.hostmask(), ch))
+		}
+	}
+}
+
+// register welcomes the client once it has sent both NICK and USER
+func (s *Server) register() {
+	if s.registered || s.nick == "" || s.user == "" {
+		return
+	}
+	s.registered = true
+	s.send(fmt.Sprintf(":%s 001 %s :Welcome to the test network %s", serverName, s.nick, s.hostmask()))
+	s.send(fmt.Sprintf(":%s 376 %s :End of /MOTD command.", serverName, s.nick))
+}
+
+// hostmask returns the hostmask of the client
+func (s *Server) hostmask() string {
+	return fmt.Sprintf("%s!%s@%s", s.nick, s.user, serverName)
+}
+
+// send writes line to the client, it is called with mu held
+func (s *Server) send(line string) error {
+	if s.conn == nil {
+		return errors.New("no client connected")
+	}
+	_, err := s.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// hostmask expands a plain nick to nick!nick@host
+func hostmask(from string) string {
+	if strings.Contains(from, "!") {
+		return from
+	}
+	return fmt.Sprintf("%s!%s@%s.%s", from, from, from, serverName)
+}
@@ -0,0 +1,168 @@
+// Package migrate upgrades stored data to the format the code expects.
+// The schema version of each namespace is kept in a metadata bucket and
+// pending migrations are run in order in a single transaction.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	metaBucket string = "Meta"
+
+	backupTimeFormat string = "20060102-150405"
+)
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// Migration upgrades the data of a namespace to Version
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ns storage.Namespace) error
+}
+
+// Schema is the data of one owner, e.g. a module, stored in Namespace.
+// Migrations are sorted by version starting from 1.
+type Schema struct {
+	Name       string
+	Namespace  string
+	Migrations []Migration
+}
+
+// Step is a migration of a schema
+type Step struct {
+	Schema      string
+	Version     int
+	Description string
+}
+
+func (s Step) String() string {
+	return fmt.Sprintf("%s to version %d: %s", s.Schema, s.Version, s.Description)
+}
+
+// Options change how migrations are run
+type Options struct {
+	// DryRun runs the migrations and rolls them back
+	DryRun bool
+	// BackupPath is where the database is copied before migrating, by
+	// default a timestamped file next to the database
+	BackupPath string
+}
+
+// version is the schema version of a namespace
+type version struct {
+	Version  int
+	Migrated time.Time
+}
+
+// Run runs the pending migrations of schemas and returns them. The
+// database is backed up first unless nothing is pending or it is a dry
+// run. If a migration fails nothing is changed.
+func Run(log logger.Logger, db *bolt.DB, schemas []Schema, opts Options) ([]Step, error) {
+	for _, s := range schemas {
+		if err := validate(s); err != nil {
+			return nil, err
+		}
+	}
+
+	var steps []Step
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		steps, err = pending(storage.NewBoltTx(tx), schemas)
+		return err
+	})
+	if err != nil || len(steps) == 0 {
+		return nil, err
+	}
+
+	if !opts.DryRun {
+		path := opts.BackupPath
+		if path == "" {
+			path = fmt.Sprintf("%s.%s.bak", db.Path(), time.Now().Format(backupTimeFormat))
+		}
+		log.Infof("backing up database to %s before migrating", path)
+		err := db.View(func(tx *bolt.Tx) error {
+			return tx.CopyFile(path, 0600)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("can't back up database: %v", err)
+		}
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if err := migrate(log, storage.NewBoltTx(tx), schemas); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// validate checks that the versions of s increase by one from 1
+func validate(s Schema) error {
+	for i, m := range s.Migrations {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %d of %s has version %d, want %d", i, s.Name, m.Version, i+1)
+		}
+		if m.Up == nil {
+			return fmt.Errorf("migration %d of %s does nothing", m.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// pending returns the migrations not yet run on root
+func pending(root storage.Namespace, schemas []Schema) ([]Step, error) {
+	meta := root.Collection(metaBucket, storage.JSON)
+	steps := make([]Step, 0)
+	for _, s := range schemas {
+		var v version
+		if _, err := meta.Get(s.Name, &v); err != nil {
+			return nil, fmt.Errorf("can't read schema version of %s: %v", s.Name, err)
+		}
+		if v.Version > len(s.Migrations) {
+			return nil, fmt.Errorf("schema of %s is version %d, newer than the supported version %d", s.Name, v.Version, len(s.Migrations))
+		}
+		for _, m := range s.Migrations[v.Version:] {
+			steps = append(steps, Step{Schema: s.Name, Version: m.Version, Description: m.Description})
+		}
+	}
+	return steps, nil
+}
+
+// migrate runs the pending migrations of schemas on root
+func migrate(log logger.Logger, root storage.Namespace, schemas []Schema) error {
+	meta := root.Collection(metaBucket, storage.JSON)
+	for _, s := range schemas {
+		var v version
+		if _, err := meta.Get(s.Name, &v); err != nil {
+			return fmt.Errorf("can't read schema version of %s: %v", s.Name, err)
+		}
+		ns := root.Namespace(s.Namespace)
+		for _, m := range s.Migrations[v.Version:] {
+			log.Infof("migrating %s to version %d: %s", s.Name, m.Version, m.Description)
+			if err := m.Up(ns); err != nil {
+				return fmt.Errorf("can't migrate %s to version %d: %v", s.Name, m.Version, err)
+			}
+			v = version{Version: m.Version, Migrated: time.Now()}
+			if err := meta.Put(s.Name, v); err != nil {
+				return fmt.Errorf("can't save schema version of %s: %v", s.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package migrate
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/storage"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+type record struct {
+	Name  string
+	Count int `json:",omitempty"`
+	Total int `json:",omitempty"`
+}
+
+// openDB opens a database in dir with a record in the Test namespace
+func openDB(t *testing.T, dir string) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.NewBolt(db).Namespace("Test").Collection("records", storage.JSON).Put("a", record{Name: "a", Count: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+var log = &logger.LogWrapper{SugaredLogger: zap.NewNop().Sugar()}
+
+// testSchema renames Count to Total and then doubles Total
+func testSchema() Schema {
+	update := func(fn func(r *record)) func(ns storage.Namespace) error {
+		return func(ns storage.Namespace) error {
+			c := ns.Collection("records", storage.JSON)
+			var r record
+			return c.Update("a", &r, func(found bool) error {
+				fn(&r)
+				return nil
+			})
+		}
+	}
+	return Schema{
+		Name:      "test",
+		Namespace: "Test",
+		Migrations: []Migration{
+			{Version: 1, Description: "rename count", Up: update(func(r *record) {
+				r.Total, r.Count = r.Count, 0
+			})},
+			{Version: 2, Description: "double total", Up: update(func(r *record) {
+				r.Total *= 2
+			})},
+		},
+	}
+}
+
+func get(t *testing.T, db *bolt.DB) record {
+	t.Helper()
+	var r record
+	_, err := storage.NewBolt(db).Namespace("Test").Collection("records", storage.JSON).Get("a", &r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestRun(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	db := openDB(t, dir)
+	defer db.Close()
+
+	backup := filepath.Join(dir, "backup.db")
+	steps, err := Run(log, db, []Schema{testSchema()}, Options{BackupPath: backup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Step{{"test", 1, "rename count"}, {"test", 2, "double total"}}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("Run = %v, want %v", steps, want)
+	}
+	if r := get(t, db); r != (record{Name: "a", Total: 4}) {
+		t.Errorf("migrated record is %+v", r)
+	}
+
+	// the backup has the data before migrating
+	backupDB, err := bolt.Open(backup, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("no backup: %v", err)
+	}
+	defer backupDB.Close()
+	if r := get(t, backupDB); r != (record{Name: "a", Count: 2}) {
+		t.Errorf("backed up record is %+v", r)
+	}
+
+	steps, err = Run(log, db, []Schema{testSchema()}, Options{})
+	if err != nil || len(steps) != 0 {
+		t.Errorf("second Run = %v, %v, want nothing to do", steps, err)
+	}
+}
+
+func TestNewMigration(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	db := openDB(t, dir)
+	defer db.Close()
+
+	schema := testSchema()
+	migrations := schema.Migrations
+	schema.Migrations = migrations[:1]
+	if _, err := Run(log, db, []Schema{schema}, Options{BackupPath: filepath.Join(dir, "1.bak")}); err != nil {
+		t.Fatal(err)
+	}
+	schema.Migrations = migrations
+	steps, err := Run(log, db, []Schema{schema}, Options{BackupPath: filepath.Join(dir, "2.bak")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].Version != 2 {
+		t.Errorf("Run = %v, want only version 2", steps)
+	}
+	if r := get(t, db); r.Total != 4 {
+		t.Errorf("migrated record is %+v", r)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	db := openDB(t, dir)
+	defer db.Close()
+
+	steps, err := Run(log, db, []Schema{testSchema()}, Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 {
+		t.Errorf("dry run = %v, want 2 steps", steps)
+	}
+	if r := get(t, db); r != (record{Name: "a", Count: 2}) {
+		t.Errorf("dry run changed the record to %+v", r)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.bak"))
+	if len(files) != 0 {
+		t.Errorf("dry run made backups %v", files)
+	}
+}
+
+func TestFailedMigration(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	db := openDB(t, dir)
+	defer db.Close()
+
+	schema := testSchema()
+	schema.Migrations = append(schema.Migrations, Migration{
+		Version:     3,
+		Description: "fail",
+		Up: func(storage.Namespace) error {
+			return errors.New("failed")
+		},
+	})
+	if _, err := Run(log, db, []Schema{schema}, Options{BackupPath: filepath.Join(dir, "test.bak")}); err == nil {
+		t.Fatal("failing migration succeeded")
+	}
+	if r := get(t, db); r != (record{Name: "a", Count: 2}) {
+		t.Errorf("failed migration changed the record to %+v", r)
+	}
+	// nothing was recorded, the working migrations run again
+	steps, err := Run(log, db, []Schema{testSchema()}, Options{DryRun: true})
+	if err != nil || len(steps) != 2 {
+		t.Errorf("Run after failure = %v, %v", steps, err)
+	}
+}
+
+func TestInvalidSchemas(t *testing.T) {
+	dir := testDir(t)
+	defer os.RemoveAll(dir)
+	db := openDB(t, dir)
+	defer db.Close()
+
+	skipped := testSchema()
+	skipped.Migrations[1].Version = 3
+	if _, err := Run(log, db, []Schema{skipped}, Options{DryRun: true}); err == nil {
+		t.Error("skipped version was accepted")
+	}
+
+	if _, err := Run(log, db, []Schema{testSchema()}, Options{BackupPath: filepath.Join(dir, "test.bak")}); err != nil {
+		t.Fatal(err)
+	}
+	older := testSchema()
+	older.Migrations = older.Migrations[:1]
+	if _, err := Run(log, db, []Schema{older}, Options{}); err == nil {
+		t.Error("data newer than the code was accepted")
+	}
+}
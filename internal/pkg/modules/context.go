@@ -0,0 +1,47 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+)
+
+// Context is passed to a module when it is run for a command or a
+// global listener
+type Context struct {
+	// Event is the event that triggered the run
+	*Event
+	// Ctx is cancelled when the run should be abandoned
+	Ctx context.Context
+	// Command is the command without prefix, empty for global listeners
+	Command string
+	// Args are the arguments after the command, or every word of the
+	// message for global listeners
+	Args []string
+	// Flags are the --name=value options of commands that declare them
+	// in their help, other commands get them in Args
+	Flags map[string]string
+
+	responder Responder
+}
+
+// NewContext constructs a new Context replying through responder
+func NewContext(ctx context.Context, e *Event, command string, args []string, responder Responder) *Context {
+	return &Context{
+		Event:     e,
+		Ctx:       ctx,
+		Command:   command,
+		Args:      args,
+		Flags:     make(map[string]string),
+		responder: responder,
+	}
+}
+
+// Reply sends message to the Target of the event
+func (c *Context) Reply(message string) {
+	c.responder.Reply(c.Event, message)
+}
+
+// Replyf formats and sends a message to the Target of the event
+func (c *Context) Replyf(format string, args ...interface{}) {
+	c.Reply(fmt.Sprintf(format, args...))
+}
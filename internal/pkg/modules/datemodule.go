@@ -1,11 +1,11 @@
 package modules
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/huqa/gofibot/internal/pkg/logger"
-	"github.com/lrstanley/girc"
 )
 
 // DateModule Dates input back to channel
@@ -18,16 +18,28 @@ const (
 	dateString string = `Tänään on %s %s (viikko %d) vuoden %d. päivä.`
 )
 
-var ignoredChannels = map[string]int{}
-
 // NewDateModule constructs new DateModule
-func NewDateModule(log logger.Logger, client *girc.Client, location *time.Location) *DateModule {
+func NewDateModule(log logger.Logger, responder Responder, location *time.Location) *DateModule {
 	return &DateModule{
 		&Module{
-			log:      log.Named("Datemodule"),
-			commands: []string{"date", "pvm"},
-			client:   client,
-			event:    "PRIVMSG",
+			name:        "date",
+			log:         log.Named("Datemodule"),
+			commands:    []string{"date", "pvm"},
+			responder:   responder,
+			events:      []string{EventPrivmsg},
+			contexts:    ContextAll,
+			cooldown:    10 * time.Second,
+			description: "tells the date, week and day of the year",
+			help: []CommandHelp{
+				{
+					Command:     "date",
+					Aliases:     []string{"pvm"},
+					Description: "tells today's date, week number and day of the year",
+				},
+			},
+			jobs: []Job{
+				{Name: "daily", Spec: "@daily", Channels: []string{AllChannels}},
+			},
 		},
 		location,
 	}
@@ -44,19 +56,32 @@ func (m *DateModule) Stop() error {
 	return nil
 }
 
-// Run Dates input to PRIVMSG target channel
-func (m *DateModule) Run(channel, hostmask, user, command string, args []string) error {
-	if _, ok := ignoredChannels[channel]; ok {
-		return nil
-	}
+// Handle Dates input to PRIVMSG target channel
+func (m *DateModule) Handle(c *Context) error {
+	c.Reply(m.today())
+	return nil
+}
+
+// RunJob tells the date on channel
+func (m *DateModule) RunJob(ctx context.Context, jobName, channel string) error {
+	m.responder.Message(channel, m.today())
+	return nil
+}
+
+// today returns the date of today in finnish
+func (m *DateModule) today() string {
 	now := time.Now().In(m.location)
 	weekday := m.finnishWeekday(now.Weekday().String())
 	date := now.Format("2.1.2006")
 	yearDay := now.YearDay()
 	_, week := now.ISOWeek()
 
-	m.client.Cmd.Message(channel, fmt.Sprintf(dateString, weekday, date, week, yearDay))
-	return nil
+	return fmt.Sprintf(dateString, weekday, date, week, yearDay)
+}
+
+// Name returns the name of this module
+func (m *DateModule) Name() string {
+	return m.name
 }
 
 // Commands returns commands used by this module
@@ -64,9 +89,24 @@ func (m *DateModule) Commands() []string {
 	return m.commands
 }
 
-// Event returns event type used by this module
-func (m *DateModule) Event() string {
-	return m.event
+// Description returns what this module does
+func (m *DateModule) Description() string {
+	return m.description
+}
+
+// Help returns help for commands of this module
+func (m *DateModule) Help() []CommandHelp {
+	return m.help
+}
+
+// Jobs returns the scheduled jobs of this module
+func (m *DateModule) Jobs() []Job {
+	return m.jobs
+}
+
+// Events returns event types used by this module
+func (m *DateModule) Events() []string {
+	return m.events
 }
 
 // Global returns true if this module is a global command
@@ -74,13 +114,14 @@ func (m *DateModule) Global() bool {
 	return m.global
 }
 
-// Schedule
-func (m *DateModule) Schedule() (bool, time.Time, time.Duration) {
-	dur, _ := time.ParseDuration("24h")
-	t := time.Now().In(m.location)
-	n := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, m.location)
-	n = n.Add(dur)
-	return true, n, dur
+// Contexts returns where this module accepts messages from
+func (m *DateModule) Contexts() MessageContext {
+	return m.contexts
+}
+
+// Cooldown returns how often a user may run commands of this module
+func (m *DateModule) Cooldown() time.Duration {
+	return m.cooldown
 }
 
 func (m *DateModule) finnishWeekday(weekday string) string {
@@ -4,8 +4,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/huqa/gofibot/internal/pkg/cmdline"
 	"github.com/huqa/gofibot/internal/pkg/logger"
-	"github.com/lrstanley/girc"
 )
 
 // EchoModule echos input back to channel
@@ -14,13 +14,26 @@ type EchoModule struct {
 }
 
 // NewEchoModule constructs new EchoModule
-func NewEchoModule(log logger.Logger, client *girc.Client) *EchoModule {
+func NewEchoModule(log logger.Logger, responder Responder) *EchoModule {
 	return &EchoModule{
 		&Module{
-			log:      log.Named("echomodule"),
-			commands: []string{"echo"},
-			client:   client,
-			event:    "PRIVMSG",
+			name:        "echo",
+			log:         log.Named("echomodule"),
+			commands:    []string{"echo"},
+			responder:   responder,
+			events:      []string{EventPrivmsg},
+			contexts:    ContextAll,
+			description: "echoes messages back",
+			help: []CommandHelp{
+				{
+					Command:     "echo",
+					Description: "repeats the message back to you",
+					Args: &cmdline.Spec{
+						Args: []cmdline.Arg{{Name: "message", Variadic: true}},
+					},
+					Examples: []string{"echo hello"},
+				},
+			},
 		},
 	}
 }
@@ -36,21 +49,36 @@ func (m *EchoModule) Stop() error {
 	return nil
 }
 
-// Run echos input to PRIVMSG target channel
-func (m *EchoModule) Run(channel, hostmask, user, command string, args []string) error {
-	message := strings.Join(args, " ")
-	m.client.Cmd.Message(channel, user+": "+message)
+// Handle echos input to PRIVMSG target channel
+func (m *EchoModule) Handle(c *Context) error {
+	message := strings.Join(c.Args, " ")
+	c.Reply(c.Source.Name + ": " + message)
 	return nil
 }
 
+// Name returns the name of this module
+func (m *EchoModule) Name() string {
+	return m.name
+}
+
 // Commands returns commands used by this module
 func (m *EchoModule) Commands() []string {
 	return m.commands
 }
 
-// Event returns event type used by this module
-func (m *EchoModule) Event() string {
-	return m.event
+// Description returns what this module does
+func (m *EchoModule) Description() string {
+	return m.description
+}
+
+// Help returns help for commands of this module
+func (m *EchoModule) Help() []CommandHelp {
+	return m.help
+}
+
+// Events returns event types used by this module
+func (m *EchoModule) Events() []string {
+	return m.events
 }
 
 // Global returns true if this module is a global command
@@ -58,7 +86,12 @@ func (m *EchoModule) Global() bool {
 	return m.global
 }
 
-// Schedule
-func (m *EchoModule) Schedule() (bool, time.Time, time.Duration) {
-	return false, time.Time{}, 0
+// Contexts returns where this module accepts messages from
+func (m *EchoModule) Contexts() MessageContext {
+	return m.contexts
+}
+
+// Cooldown returns how often a user may run commands of this module
+func (m *EchoModule) Cooldown() time.Duration {
+	return m.cooldown
 }
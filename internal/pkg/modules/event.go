@@ -0,0 +1,137 @@
+package modules
+
+import (
+	"context"
+
+	"github.com/lrstanley/girc"
+)
+
+// Event types modules can subscribe to
+const (
+	EventPrivmsg string = girc.PRIVMSG
+	EventNotice  string = girc.NOTICE
+	EventAction  string = girc.CTCP_ACTION
+	EventJoin    string = girc.JOIN
+	EventPart    string = girc.PART
+	EventQuit    string = girc.QUIT
+	EventNick    string = girc.NICK
+	EventKick    string = girc.KICK
+	EventTopic   string = girc.TOPIC
+)
+
+// EventListener is implemented by modules that react to events other than
+// commands and global PRIVMSG listeners, see Events(). ctx is cancelled
+// when the run times out or the bot shuts down.
+type EventListener interface {
+	OnEvent(ctx context.Context, e *Event) error
+}
+
+// Event is an irc event passed to modules
+type Event struct {
+	// Type is one of the Event* constants
+	Type string
+	// Raw is the original girc event
+	Raw *girc.Event
+	// Source is the user who caused the event
+	Source *girc.Source
+	// Account is the services account of Source if known
+	Account string
+	// Channel is the channel the event happened on, empty for private
+	// messages, QUIT and NICK
+	Channel string
+	// Target is where replies to this event should be sent
+	Target string
+	// Private is true for messages sent directly to the bot
+	Private bool
+	// Message is the message text, part, quit or kick reason or new topic
+	Message string
+	// Nick is the new nick for NICK and the kicked user for KICK
+	Nick string
+}
+
+// IRCCommand returns the girc event command the event type arrives as
+func IRCCommand(eventType string) string {
+	if eventType == EventAction {
+		return girc.PRIVMSG
+	}
+	return eventType
+}
+
+// NewEvent converts a girc event to an Event, it returns nil for events
+// modules can't subscribe to
+func NewEvent(e *girc.Event) *Event {
+	if e.Source == nil {
+		return nil
+	}
+	ev := &Event{
+		Type:   e.Command,
+		Raw:    e,
+		Source: e.Source,
+	}
+	if account, ok := e.Tags.Get("account"); ok && account != "*" {
+		ev.Account = account
+	}
+	switch e.Command {
+	case girc.PRIVMSG, girc.NOTICE:
+		if len(e.Params) < 2 {
+			return nil
+		}
+		ev.Message = e.Last()
+		if e.IsAction() {
+			ev.Type = EventAction
+			ev.Message = e.StripAction()
+		} else if ok, _ := e.IsCTCP(); ok {
+			return nil
+		}
+		if e.IsFromChannel() {
+			ev.Channel = e.Params[0]
+			ev.Target = ev.Channel
+		} else {
+			ev.Private = true
+			ev.Target = e.Source.Name
+		}
+	case girc.JOIN, girc.PART, girc.TOPIC:
+		if len(e.Params) < 1 {
+			return nil
+		}
+		ev.Channel = e.Params[0]
+		ev.Target = ev.Channel
+		if len(e.Params) > 1 {
+			ev.Message = e.Last()
+		}
+	case girc.KICK:
+		if len(e.Params) < 2 {
+			return nil
+		}
+		ev.Channel = e.Params[0]
+		ev.Target = ev.Channel
+		ev.Nick = e.Params[1]
+		if len(e.Params) > 2 {
+			ev.Message = e.Last()
+		}
+	case girc.QUIT:
+		ev.Target = e.Source.Name
+		if len(e.Params) > 0 {
+			ev.Message = e.Last()
+		}
+	case girc.NICK:
+		if len(e.Params) < 1 {
+			return nil
+		}
+		ev.Nick = e.Last()
+		ev.Target = ev.Nick
+	default:
+		return nil
+	}
+	return ev
+}
+
+// Subscribes returns true if module md listens to eventType
+func Subscribes(md ModuleInterface, eventType string) bool {
+	for _, e := range md.Events() {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -1,24 +1,24 @@
 package modules
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
 	"math/rand"
 	"sort"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/huqa/gofibot/internal/pkg/cmdline"
 	"github.com/huqa/gofibot/internal/pkg/logger"
+	"github.com/huqa/gofibot/internal/pkg/migrate"
+	"github.com/huqa/gofibot/internal/pkg/storage"
 	"github.com/huqa/gofibot/internal/pkg/utils"
-	"github.com/lrstanley/girc"
-	bolt "go.etcd.io/bbolt"
 )
 
 const (
-	guessRootBucket  string = `Guess`
-	guessStatsBucket string = `Stats`
-	guessRollsBucket string = `Rolls`
+	guessStatsCollection string = `Stats`
+	guessRollsCollection string = `Rolls`
 
 	guessLimitPerDay int = 5
 
@@ -43,22 +43,47 @@ type Roll struct {
 type GuessModule struct {
 	*Module
 	location     *time.Location
-	db           *bolt.DB
+	guesses      storage.Collection
+	rolls        storage.Collection
+	mu           sync.Mutex
 	guessesToday map[string]int
 }
 
 // NewGuessModule constructs a new GuessModule
-func NewGuessModule(log logger.Logger, client *girc.Client, db *bolt.DB, location *time.Location) *GuessModule {
+func NewGuessModule(log logger.Logger, responder Responder, store storage.Namespace, location *time.Location) *GuessModule {
 	return &GuessModule{
 		&Module{
-			log:      log.Named("guessmodule"),
-			client:   client,
-			global:   false,
-			event:    "PRIVMSG",
-			commands: []string{"arvaa", statsCommand},
+			name:        "guess",
+			log:         log.Named("guessmodule"),
+			responder:   responder,
+			global:      false,
+			events:      []string{EventPrivmsg},
+			contexts:    ContextAll,
+			cooldown:    2 * time.Second,
+			commands:    []string{"arvaa", statsCommand},
+			description: fmt.Sprintf("a dice guessing game with %d guesses per day", guessLimitPerDay),
+			help: []CommandHelp{
+				{
+					Command:     "arvaa",
+					Description: "guess the roll of a 200 sided die, without a number shows your own stats",
+					Args: &cmdline.Spec{
+						Args: []cmdline.Arg{{Name: "1-200", Optional: true}},
+					},
+					Examples: []string{"arvaa 42", "arvaa"},
+				},
+				{
+					Command:     statsCommand,
+					Description: "shows the most rolled and most correctly guessed numbers",
+				},
+			},
+			jobs: []Job{
+				{Name: "reset", Spec: "@daily"},
+			},
 		},
 		location,
-		db,
+		store.Collection(guessStatsCollection, storage.JSON),
+		store.Collection(guessRollsCollection, storage.JSON),
+		sync.Mutex{},
 		make(map[string]int),
 	}
 }
@@ -66,27 +91,6 @@ func NewGuessModule(log logger.Logger, client *girc.Client, db *bolt.DB, locatio
 // Init initializes Guess module
 func (m *GuessModule) Init() error {
 	m.log.Info("Init")
-
-	err := m.db.Update(func(tx *bolt.Tx) error {
-		root, err := tx.CreateBucketIfNotExists([]byte(guessRootBucket))
-		if err != nil {
-			return fmt.Errorf("could not create root bucket: %v", err)
-		}
-		_, err = root.CreateBucketIfNotExists([]byte(guessStatsBucket))
-		if err != nil {
-			return fmt.Errorf("could not create weight bucket: %v", err)
-		}
-		_, err = root.CreateBucketIfNotExists([]byte(guessRollsBucket))
-		if err != nil {
-			return fmt.Errorf("could not create days bucket: %v", err)
-		}
-		return nil
-	})
-
-	if err != nil {
-		return fmt.Errorf("could not set up buckets, %v", err)
-	}
-
 	return nil
 }
 
@@ -95,9 +99,10 @@ func (m *GuessModule) Stop() error {
 	return nil
 }
 
-// Run Stats input to PRIVMSG target channel
-func (m *GuessModule) Run(channel, hostmask, user, command string, args []string) error {
-	if command == statsCommand {
+// Handle Stats input to PRIVMSG target channel
+func (m *GuessModule) Handle(c *Context) error {
+	user := c.Source.Name
+	if c.Command == statsCommand {
 		rolls, _, err := m.getRollStats()
 		if err != nil {
 			m.Module.log.Error("roll stats error", err)
@@ -129,43 +134,39 @@ func (m *GuessModule) Run(channel, hostmask, user, command string, args []string
 			}
 			i++
 		}
-		m.client.Cmd.Message(channel, "!arvaa-stats TOP 10 heitetyt luvut (nopanluku:määrä)")
-		m.client.Cmd.Message(channel, output)
+		c.Reply("!arvaa-stats TOP 10 heitetyt luvut (nopanluku:määrä)")
+		c.Reply(output)
 
-		m.client.Cmd.Message(channel, "!arvaa-stats TOP 10 oikein arvatut luvut (nopanluku:määrä)")
-		m.client.Cmd.Message(channel, output1)
+		c.Reply("!arvaa-stats TOP 10 oikein arvatut luvut (nopanluku:määrä)")
+		c.Reply(output1)
 
 		return nil
 	}
-	if hostmask == "SYSTEM" && user == "SYSTEM" {
-		m.resetDailyGuesses()
-		return nil
-	}
-	if len(args) == 0 {
+	if len(c.Args) == 0 {
 		guesses, rights, err := m.getPlayerStats(user)
 		if err != nil {
-			m.client.Cmd.Message(channel, fmt.Sprintf("!arvaa - %s no bonus", user))
+			c.Replyf("!arvaa - %s no bonus", user)
 			return err
 		}
 		percent := (float64(rights) / float64(guesses)) * 100.0
-		m.client.Cmd.Message(channel, fmt.Sprintf("!arvaa - %s olet arvannut %d kertaa joista %d on ollut oikein - onnistumisprosentti: %.2f", user, guesses, rights, percent))
+		c.Replyf("!arvaa - %s olet arvannut %d kertaa joista %d on ollut oikein - onnistumisprosentti: %.2f", user, guesses, rights, percent)
 		return nil
 	}
 
-	guess, err := strconv.ParseInt(args[0], 10, 64)
+	guess, err := strconv.ParseInt(c.Args[0], 10, 64)
 	if err != nil {
-		m.client.Cmd.Message(channel, fmt.Sprintf("!arvaa - %s painu takas neukkulaan", user))
+		c.Replyf("!arvaa - %s painu takas neukkulaan", user)
 		return nil
 	}
 
 	if guess <= 0 || guess > 200 {
-		m.client.Cmd.Message(channel, fmt.Sprintf("!arvaa - %s anna luku väliltä 1-200", user))
+		c.Replyf("!arvaa - %s anna luku väliltä 1-200", user)
 		return nil
 	}
 
 	guessesLeft := m.handleGuessLimit(user)
 	if guessesLeft < 0 {
-		m.client.Cmd.Message(channel, fmt.Sprintf("!arvaa - %s ei arvauksia jäljellä tänään", user))
+		c.Replyf("!arvaa - %s ei arvauksia jäljellä tänään", user)
 		return nil
 	}
 
@@ -175,11 +176,11 @@ func (m *GuessModule) Run(channel, hostmask, user, command string, args []string
 	max := 200
 	throw := rand.Intn(max-min+1) + min
 
-	m.client.Cmd.Message(channel, fmt.Sprintf("!arvaa - %s arvasi %d ja heitti %d - arvauksia jäljellä %d", user, guess, throw, guessesLeft))
+	c.Replyf("!arvaa - %s arvasi %d ja heitti %d - arvauksia jäljellä %d", user, guess, throw, guessesLeft)
 
 	if int64(throw) == guess {
 		wasRight = true
-		m.client.Cmd.Message(channel, fmt.Sprintf("!arvaa - %s CONGRATURATIONS YOU WINRAR", user))
+		c.Replyf("!arvaa - %s CONGRATURATIONS YOU WINRAR", user)
 	}
 	err = m.upsertRoll(throw, wasRight)
 	if err != nil {
@@ -192,14 +193,34 @@ func (m *GuessModule) Run(channel, hostmask, user, command string, args []string
 	return nil
 }
 
+// Name returns the name of this module
+func (m *GuessModule) Name() string {
+	return m.name
+}
+
 // Commands returns commands used by this module
 func (m *GuessModule) Commands() []string {
 	return m.commands
 }
 
-// Event returns event type used by this module
-func (m *GuessModule) Event() string {
-	return m.event
+// Description returns what this module does
+func (m *GuessModule) Description() string {
+	return m.description
+}
+
+// Help returns help for commands of this module
+func (m *GuessModule) Help() []CommandHelp {
+	return m.help
+}
+
+// Jobs returns the scheduled jobs of this module
+func (m *GuessModule) Jobs() []Job {
+	return m.jobs
+}
+
+// Events returns event types used by this module
+func (m *GuessModule) Events() []string {
+	return m.events
 }
 
 // Global returns true if this module is a global command
@@ -207,16 +228,78 @@ func (m *GuessModule) Global() bool {
 	return m.global
 }
 
-// Schedule returns true, time.Time if this module is scheduled to be run at time.Time
-func (m *GuessModule) Schedule() (bool, time.Time, time.Duration) {
-	dur, _ := time.ParseDuration("24h")
-	t := time.Now().In(m.location)
-	n := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, m.location)
-	n = n.Add(dur)
-	return true, n, dur
+// Contexts returns where this module accepts messages from
+func (m *GuessModule) Contexts() MessageContext {
+	return m.contexts
+}
+
+// Cooldown returns how often a user may run commands of this module
+func (m *GuessModule) Cooldown() time.Duration {
+	return m.cooldown
+}
+
+// RunJob resets the daily guesses
+func (m *GuessModule) RunJob(ctx context.Context, jobName, channel string) error {
+	m.resetDailyGuesses()
+	return nil
+}
+
+// Migrations returns the schema versions of the guess data
+func (m *GuessModule) Migrations() []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version:     1,
+			Description: "guesses keyed by nick and rolls keyed by value",
+			Up:          func(ns storage.Namespace) error { return nil },
+		},
+		{
+			Version:     2,
+			Description: "drop invalid guesses and rolls and fill in missing nicks and values",
+			Up:          migrateGuesses,
+		},
+	}
+}
+
+// migrateGuesses removes guesses and rolls that can't be decoded and sets
+// the nick of guesses and the value of rolls from their keys
+func migrateGuesses(ns storage.Namespace) error {
+	err := migrateCollection(ns.Collection(guessStatsCollection, storage.JSON), func(key string, decode func(v interface{}) error) (interface{}, bool, error) {
+		var g Guess
+		if err := decode(&g); err != nil {
+			return nil, false, err
+		}
+		if g.Nick != "" {
+			return nil, false, nil
+		}
+		g.Nick = key
+		return g, true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("can't migrate guesses: %v", err)
+	}
+	err = migrateCollection(ns.Collection(guessRollsCollection, storage.JSON), func(key string, decode func(v interface{}) error) (interface{}, bool, error) {
+		if len(key) != 8 {
+			return nil, false, fmt.Errorf("invalid key %q", key)
+		}
+		var r Roll
+		if err := decode(&r); err != nil {
+			return nil, false, err
+		}
+		if r.Value != 0 {
+			return nil, false, nil
+		}
+		r.Value = utils.Btoi([]byte(key))
+		return r, true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("can't migrate rolls: %v", err)
+	}
+	return nil
 }
 
 func (m *GuessModule) handleGuessLimit(nick string) (guessesLeft int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	guessesLeft = 0
 	if guesses, ok := m.guessesToday[nick]; ok {
 		guessesLeft = guesses - 1
@@ -233,6 +316,8 @@ func (m *GuessModule) handleGuessLimit(nick string) (guessesLeft int) {
 }
 
 func (m *GuessModule) resetDailyGuesses() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.guessesToday = make(map[string]int)
 }
 
@@ -242,33 +327,14 @@ func (m *GuessModule) upsertGuess(nick string, wasRight bool) error {
 	if wasRight == true {
 		wr = 1
 	}
-	return m.db.Update(func(tx *bolt.Tx) error {
-		guessBucket := tx.Bucket([]byte(guessRootBucket)).Bucket([]byte(guessStatsBucket))
-		guessBytes := guessBucket.Get([]byte(nick))
-		if guessBytes == nil {
-			insert := Guess{
-				Nick:    nick,
-				Guesses: 1,
-				Rights:  wr,
-			}
-			enc, err := json.Marshal(insert)
-			if err != nil {
-				return err
-			}
-			return guessBucket.Put([]byte(nick), enc)
-		}
-		var g Guess
-		err := json.Unmarshal(guessBytes, &g)
-		if err != nil {
-			return err
+	var g Guess
+	return m.guesses.Update(nick, &g, func(found bool) error {
+		if !found {
+			g = Guess{Nick: nick}
 		}
 		g.Guesses = g.Guesses + 1
 		g.Rights = g.Rights + wr
-		enc, err := json.Marshal(g)
-		if err != nil {
-			return err
-		}
-		return guessBucket.Put([]byte(nick), enc)
+		return nil
 	})
 }
 
@@ -278,74 +344,37 @@ func (m *GuessModule) upsertRoll(number int, wasRight bool) error {
 	if wasRight == true {
 		wr = 1
 	}
-	return m.db.Update(func(tx *bolt.Tx) error {
-		rollsBucket := tx.Bucket([]byte(guessRootBucket)).Bucket([]byte(guessRollsBucket))
-		rollBytes := rollsBucket.Get(utils.Itob(number))
-		if rollBytes == nil {
-			insert := Roll{
-				Value:  number,
-				Rolls:  1,
-				Rights: wr,
-			}
-			enc, err := json.Marshal(insert)
-			if err != nil {
-				return err
-			}
-			return rollsBucket.Put(utils.Itob(number), enc)
-		}
-		var r Roll
-		err := json.Unmarshal(rollBytes, &r)
-		if err != nil {
-			return err
+	var r Roll
+	return m.rolls.Update(string(utils.Itob(number)), &r, func(found bool) error {
+		if !found {
+			r = Roll{Value: number}
 		}
 		r.Rolls = r.Rolls + 1
 		r.Rights = r.Rights + wr
-		enc, err := json.Marshal(r)
-		if err != nil {
-			return err
-		}
-		return rollsBucket.Put(utils.Itob(number), enc)
+		return nil
 	})
 }
 
 func (m *GuessModule) getPlayerStats(nick string) (guesses int, rights int, err error) {
-	err = m.db.View(func(tx *bolt.Tx) error {
-		guessBucket := tx.Bucket([]byte(guessRootBucket)).Bucket([]byte(guessStatsBucket))
-		guessBytes := guessBucket.Get([]byte(nick))
-		if guessBytes == nil {
-			guesses = 0
-			rights = 0
-			return errors.New("no user data found")
-		}
-		var g Guess
-		err := json.Unmarshal(guessBytes, &g)
-		if err != nil {
-			return err
-		}
-		guesses = g.Guesses
-		rights = g.Rights
-		return nil
-	})
-	return guesses, rights, nil
+	var g Guess
+	_, err = m.guesses.Get(nick, &g)
+	if err != nil {
+		return 0, 0, err
+	}
+	return g.Guesses, g.Rights, nil
 }
 
 func (m *GuessModule) getRollStats() (rolls []Roll, keys []int, err error) {
 	rolls = make([]Roll, 0)
 	keys = make([]int, 0)
-	err = m.db.View(func(tx *bolt.Tx) error {
-		rollBucket := tx.Bucket([]byte(guessRootBucket)).Bucket([]byte(guessRollsBucket))
-		return rollBucket.ForEach(func(k, v []byte) error {
-			var key int
-			key = utils.Btoi(k)
-			keys = append(keys, key)
-			var r Roll
-			err := json.Unmarshal(v, &r)
-			if err != nil {
-				return err
-			}
-			rolls = append(rolls, r)
-			return nil
-		})
+	err = m.rolls.Iterate(func(key string, decode func(v interface{}) error) error {
+		var r Roll
+		if err := decode(&r); err != nil {
+			return err
+		}
+		keys = append(keys, utils.Btoi([]byte(key)))
+		rolls = append(rolls, r)
+		return nil
 	})
 	if err != nil {
 		return rolls, keys, err
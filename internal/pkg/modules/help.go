@@ -0,0 +1,58 @@
+package modules
+
+import (
+	"strings"
+
+	"github.com/huqa/gofibot/internal/pkg/cmdline"
+)
+
+// CommandHelp documents a command for the help command
+type CommandHelp struct {
+	// Command is the command without prefix
+	Command string
+	// Aliases are other commands that run the same thing
+	Aliases []string
+	// Description tells what the command does
+	Description string
+	// Usage lists the arguments of the command, e.g. "[location]"
+	Usage string
+	// Args declares the arguments and options of the command. Commands
+	// with bad arguments are answered with a usage error instead of run.
+	Args *cmdline.Spec
+	// Examples are complete example invocations without prefix
+	Examples []string
+}
+
+// ArgsUsage returns Usage or the usage generated from Args
+func (h CommandHelp) ArgsUsage() string {
+	if h.Usage == "" && h.Args != nil {
+		return h.Args.Usage()
+	}
+	return h.Usage
+}
+
+// Helper is implemented by modules that document themselves and their
+// commands for the help command
+type Helper interface {
+	Description() string
+	Help() []CommandHelp
+}
+
+// FindHelp returns the help of command or its alias if md documents it
+func FindHelp(md ModuleInterface, command string) (CommandHelp, bool) {
+	helper, ok := md.(Helper)
+	if !ok {
+		return CommandHelp{}, false
+	}
+	for _, h := range helper.Help() {
+		if strings.EqualFold(h.Command, command) {
+			return h, true
+		}
+		for _, alias := range h.Aliases {
+			if strings.EqualFold(alias, command) {
+				return h, true
+			}
+		}
+	}
+	return CommandHelp{}, false
+}
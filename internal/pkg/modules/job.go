@@ -0,0 +1,28 @@
+package modules
+
+import "context"
+
+// AllChannels targets a job at every channel the bot is on
+const AllChannels string = "*"
+
+// Job is a scheduled run of a module
+type Job struct {
+	// Name identifies the job within its module
+	Name string
+	// Spec is a cron expression evaluated in the location of the bot,
+	// e.g. "0 0 * * *" or "@daily"
+	Spec string
+	// Channels the job runs on. AllChannels runs it on every channel of
+	// the bot, without channels it runs once without a channel.
+	Channels []string
+	// CatchUp runs the job at startup if its last run was missed
+	CatchUp bool
+}
+
+// Scheduled is implemented by modules with scheduled jobs. RunJob is
+// called for each channel of a job with the name of the job, channel is
+// empty for jobs without channels.
+type Scheduled interface {
+	Jobs() []Job
+	RunJob(ctx context.Context, jobName, channel string) error
+}
@@ -0,0 +1,45 @@
+package modules
+
+import (
+	"github.com/huqa/gofibot/internal/pkg/migrate"
+	"github.com/huqa/gofibot/internal/pkg/storage"
+)
+
+// Migrating is implemented by modules whose stored data has changed
+// format. The migrations are run on the namespace of the module at
+// startup before the module is initialized.
+type Migrating interface {
+	Migrations() []migrate.Migration
+}
+
+// migrateCollection calls fix for each value of c. Values fix returns an
+// error for are deleted and values it changes are stored.
+func migrateCollection(c storage.Collection, fix func(key string, decode func(v interface{}) error) (interface{}, bool, error)) error {
+	invalid := make([]string, 0)
+	keys := make([]string, 0)
+	fixed := make([]interface{}, 0)
+	err := c.Iterate(func(key string, decode func(v interface{}) error) error {
+		v, changed, err := fix(key, decode)
+		if err != nil {
+			invalid = append(invalid, key)
+		} else if changed {
+			keys = append(keys, key)
+			fixed = append(fixed, v)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range invalid {
+		if err := c.Delete(key); err != nil {
+			return err
+		}
+	}
+	for i, key := range keys {
+		if err := c.Put(key, fixed[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,25 +4,53 @@ import (
 	"time"
 
 	"github.com/huqa/gofibot/internal/pkg/logger"
-	"github.com/lrstanley/girc"
 )
 
 // ModuleInterface defines a common interface to be used in modules
 type ModuleInterface interface {
+	Name() string
 	Init() error
 	Stop() error
-	Run(channel, hostmask, user, command string, args []string) error
-	Event() string
+	Handle(c *Context) error
+	Events() []string
 	Commands() []string
 	Global() bool
-	Schedule() (bool, time.Time, time.Duration)
+	Contexts() MessageContext
+	Cooldown() time.Duration
+}
+
+// MessageContext defines where a module accepts messages from
+type MessageContext int
+
+// Message contexts, combine with | to accept both
+const (
+	ContextChannel MessageContext = 1 << iota
+	ContextPrivate
+
+	ContextAll = ContextChannel | ContextPrivate
+)
+
+// Accepts returns true if messages from a private query or a channel
+// are accepted in this context
+func (c MessageContext) Accepts(private bool) bool {
+	if private {
+		return c&ContextPrivate != 0
+	}
+	return c&ContextChannel != 0
 }
 
 // Module defines basic fields for modules
 type Module struct {
-	log      logger.Logger
-	commands []string
-	client   *girc.Client
-	event    string
-	global   bool
+	name      string
+	log       logger.Logger
+	commands  []string
+	responder Responder
+	events    []string
+	global    bool
+	contexts  MessageContext
+	cooldown  time.Duration
+
+	description string
+	help        []CommandHelp
+	jobs        []Job
 }
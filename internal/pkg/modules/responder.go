@@ -0,0 +1,32 @@
+package modules
+
+// Sender sends output to a chat network. Implemented by transports such
+// as the irc adapter in IRCService.
+type Sender interface {
+	Message(target, message string)
+	Notice(target, message string)
+	Action(target, message string)
+	Topic(channel, topic string)
+	Kick(channel, nick, reason string)
+}
+
+// Responder is a Sender that can also reply to events
+type Responder interface {
+	Sender
+	Reply(e *Event, message string)
+}
+
+// responder adds Reply to a Sender
+type responder struct {
+	Sender
+}
+
+// NewResponder constructs a Responder sending through s
+func NewResponder(s Sender) Responder {
+	return &responder{s}
+}
+
+// Reply sends message to where e came from
+func (r *responder) Reply(e *Event, message string) {
+	r.Message(e.Target, message)
+}
@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/huqa/gofibot/internal/pkg/logger"
-	"github.com/lrstanley/girc"
 )
 
 // ShouldModule
@@ -16,13 +15,16 @@ type ShouldModule struct {
 }
 
 // NewShouldModule
-func NewShouldModule(log logger.Logger, client *girc.Client) *ShouldModule {
+func NewShouldModule(log logger.Logger, responder Responder) *ShouldModule {
 	return &ShouldModule{
 		&Module{
-			log:    log.Named("shouldmodule"),
-			client: client,
-			global: true,
-			event:  "PRIVMSG",
+			name:        "should",
+			log:         log.Named("shouldmodule"),
+			responder:   responder,
+			global:      true,
+			events:      []string{EventPrivmsg},
+			contexts:    ContextAll,
+			description: "answers questions asking whether one should do something",
 		},
 		[]string{
 			"pitäiskö",
@@ -53,37 +55,52 @@ func (m *ShouldModule) Stop() error {
 	return nil
 }
 
-// Run
-func (m *ShouldModule) Run(channel, hostmask, user, command string, args []string) error {
-	message := strings.Join(args, " ")
+// Handle
+func (m *ShouldModule) Handle(c *Context) error {
+	message := strings.Join(c.Args, " ")
 	message = strings.ToLower(message)
 	rand.Seed(time.Now().UnixNano())
 	for _, sh := range m.shoulds {
 		if strings.Contains(message, sh) {
 			i := rand.Intn(12)
 			if i == 10 {
-				m.client.Cmd.Message(channel, replyNo)
+				c.Reply(replyNo)
 				return nil
 			}
 			if i == 11 {
-				m.client.Cmd.Message(channel, replyMaybe)
+				c.Reply(replyMaybe)
 				return nil
 			}
-			m.client.Cmd.Message(channel, replyYes)
+			c.Reply(replyYes)
 			return nil
 		}
 	}
 	return nil
 }
 
+// Name returns the name of this module
+func (m *ShouldModule) Name() string {
+	return m.name
+}
+
 // Commands returns commands used by this module
 func (m *ShouldModule) Commands() []string {
 	return m.commands
 }
 
-// Event returns event type used by this module
-func (m *ShouldModule) Event() string {
-	return m.event
+// Description returns what this module does
+func (m *ShouldModule) Description() string {
+	return m.description
+}
+
+// Help returns help for commands of this module
+func (m *ShouldModule) Help() []CommandHelp {
+	return m.help
+}
+
+// Events returns event types used by this module
+func (m *ShouldModule) Events() []string {
+	return m.events
 }
 
 // Global returns true if this module is a global command
@@ -91,7 +108,12 @@ func (m *ShouldModule) Global() bool {
 	return m.global
 }
 
-// Schedule
-func (m *ShouldModule) Schedule() (bool, time.Time, time.Duration) {
-	return false, time.Time{}, 0
+// Contexts returns where this module accepts messages from
+func (m *ShouldModule) Contexts() MessageContext {
+	return m.contexts
+}
+
+// Cooldown returns how often a user may run commands of this module
+func (m *ShouldModule) Cooldown() time.Duration {
+	return m.cooldown
 }
@@ -1,19 +1,15 @@
 package modules
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/huqa/gofibot/internal/pkg/logger"
-	"github.com/lrstanley/girc"
-	bolt "go.etcd.io/bbolt"
-)
-
-const (
-	statsRootBucket    string = "Stats"
-	channelStatsBucket string = "Channel"
+	"github.com/huqa/gofibot/internal/pkg/migrate"
+	"github.com/huqa/gofibot/internal/pkg/storage"
 )
 
 // ChannelStats represents a users chat stats on a channel
@@ -28,22 +24,37 @@ type ChannelStats struct {
 type StatsModule struct {
 	*Module
 
-	db *bolt.DB
+	// store has a collection of word counts per channel
+	store storage.Namespace
 
 	location *time.Location
 }
 
 // NewStatsModule constructs a new StatsModule
-func NewStatsModule(log logger.Logger, client *girc.Client, db *bolt.DB, location *time.Location) *StatsModule {
+func NewStatsModule(log logger.Logger, responder Responder, store storage.Namespace, location *time.Location) *StatsModule {
 	return &StatsModule{
 		&Module{
-			log:      log.Named("Statsmodule"),
-			client:   client,
-			global:   true,
-			event:    "PRIVMSG",
-			commands: []string{"stats", "toptod"},
+			name:        "stats",
+			log:         log.Named("Statsmodule"),
+			responder:   responder,
+			global:      true,
+			events:      []string{EventPrivmsg, EventAction},
+			contexts:    ContextChannel,
+			cooldown:    30 * time.Second,
+			commands:    []string{"stats", "toptod"},
+			description: "counts words written on channels",
+			help: []CommandHelp{
+				{
+					Command:     "stats",
+					Aliases:     []string{"toptod"},
+					Description: "shows today's top word counts of the channel",
+				},
+			},
+			jobs: []Job{
+				{Name: "daily", Spec: "@daily", Channels: []string{AllChannels}, CatchUp: true},
+			},
 		},
-		db,
+		store,
 		location,
 	}
 }
@@ -51,19 +62,6 @@ func NewStatsModule(log logger.Logger, client *girc.Client, db *bolt.DB, locatio
 // Init initializes Stats module
 func (m *StatsModule) Init() error {
 	m.log.Info("Init")
-
-	err := m.db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(statsRootBucket))
-		if err != nil {
-			return fmt.Errorf("could not create root bucket: %v", err)
-		}
-		return nil
-	})
-
-	if err != nil {
-		return fmt.Errorf("could not set up buckets, %v", err)
-	}
-
 	return nil
 }
 
@@ -72,42 +70,85 @@ func (m *StatsModule) Stop() error {
 	return nil
 }
 
-// Run Stats input to PRIVMSG target channel
-func (m *StatsModule) Run(channel, hostmask, user, command string, args []string) error {
+// Handle Stats input to PRIVMSG target channel
+func (m *StatsModule) Handle(c *Context) error {
 	// handle global command -> upsert word count
-	if command == "" && hostmask != "SYSTEM" {
-		err := m.upsert(channel, user, hostmask, len(args))
+	if c.Command == "" {
+		err := m.upsert(c.Channel, c.Source.Name, c.Source.String(), len(c.Args))
 		if err != nil {
 			m.log.Error("upsert error: ", err)
 			return err
 		}
 		return nil
 	}
+	output, output2, err := m.selectWordStats(c.Channel)
+	if err != nil {
+		m.log.Error("can't fetch word stats: ", err)
+		return err
+	}
+	c.Reply(output)
+	c.Reply(output2)
+	return nil
+}
+
+// RunJob shows the word stats of channel and clears them for the next day
+func (m *StatsModule) RunJob(ctx context.Context, jobName, channel string) error {
 	output, output2, err := m.selectWordStats(channel)
 	if err != nil {
 		m.log.Error("can't fetch word stats: ", err)
 		return err
 	}
-	m.client.Cmd.Message(channel, output)
-	m.client.Cmd.Message(channel, output2)
-	if hostmask == "SYSTEM" && user == "SYSTEM" {
-		err = m.clearStats(channel)
-		if err != nil {
-			m.log.Error("can't clear word stats: ", err)
-		}
+	m.responder.Message(channel, output)
+	m.responder.Message(channel, output2)
+	err = m.clearStats(channel)
+	if err != nil {
+		m.log.Error("can't clear word stats: ", err)
+		return err
 	}
+	return nil
+}
 
+// OnEvent counts words of /me actions
+func (m *StatsModule) OnEvent(ctx context.Context, e *Event) error {
+	if e.Type != EventAction {
+		return nil
+	}
+	err := m.upsert(e.Channel, e.Source.Name, e.Source.String(), len(strings.Fields(e.Message)))
+	if err != nil {
+		m.log.Error("upsert error: ", err)
+		return err
+	}
 	return nil
 }
 
+// Name returns the name of this module
+func (m *StatsModule) Name() string {
+	return m.name
+}
+
 // Commands returns commands used by this module
 func (m *StatsModule) Commands() []string {
 	return m.commands
 }
 
-// Event returns event type used by this module
-func (m *StatsModule) Event() string {
-	return m.event
+// Description returns what this module does
+func (m *StatsModule) Description() string {
+	return m.description
+}
+
+// Help returns help for commands of this module
+func (m *StatsModule) Help() []CommandHelp {
+	return m.help
+}
+
+// Jobs returns the scheduled jobs of this module
+func (m *StatsModule) Jobs() []Job {
+	return m.jobs
+}
+
+// Events returns event types used by this module
+func (m *StatsModule) Events() []string {
+	return m.events
 }
 
 // Global returns true if this module is a global command
@@ -115,78 +156,92 @@ func (m *StatsModule) Global() bool {
 	return m.global
 }
 
-// Schedule returns true, time.Time if this module is scheduled to be run at time.Time
-func (m *StatsModule) Schedule() (bool, time.Time, time.Duration) {
-	dur, _ := time.ParseDuration("24h")
-	t := time.Now().In(m.location)
-	n := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, m.location)
-	n = n.Add(dur)
-	return true, n, dur
+// Contexts returns where this module accepts messages from
+func (m *StatsModule) Contexts() MessageContext {
+	return m.contexts
 }
 
-func (m *StatsModule) clearStats(channel string) error {
-	return m.db.Update(func(tx *bolt.Tx) error {
-		root := tx.Bucket([]byte(statsRootBucket))
-		chanBucket := root.Bucket([]byte(channel))
-		if chanBucket == nil {
-			return nil
+// Cooldown returns how often a user may run commands of this module
+func (m *StatsModule) Cooldown() time.Duration {
+	return m.cooldown
+}
+
+// Migrations returns the schema versions of the stats data
+func (m *StatsModule) Migrations() []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version:     1,
+			Description: "word counts per channel keyed by nick",
+			Up:          func(ns storage.Namespace) error { return nil },
+		},
+		{
+			Version:     2,
+			Description: "drop invalid word counts and fill in missing nicks and channels",
+			Up:          migrateChannelStats,
+		},
+	}
+}
+
+// migrateChannelStats removes word counts that can't be decoded and sets
+// the nick and channel of the rest from their key and collection
+func migrateChannelStats(ns storage.Namespace) error {
+	channels, err := ns.Names()
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		err := migrateCollection(ns.Collection(channel, storage.JSON), func(nick string, decode func(v interface{}) error) (interface{}, bool, error) {
+			var cs ChannelStats
+			if err := decode(&cs); err != nil {
+				return nil, false, err
+			}
+			if cs.Nick != "" && cs.Channel != "" {
+				return nil, false, nil
+			}
+			if cs.Nick == "" {
+				cs.Nick = nick
+			}
+			if cs.Channel == "" {
+				cs.Channel = channel
+			}
+			return cs, true, nil
+		})
+		if err != nil {
+			return fmt.Errorf("can't migrate stats of %s: %v", channel, err)
 		}
-		return root.DeleteBucket([]byte(channel))
-	})
+	}
+	return nil
+}
+
+func (m *StatsModule) clearStats(channel string) error {
+	return m.store.Drop(channel)
 }
 
 // upsert inserts or updates word counts on db
 func (m *StatsModule) upsert(channel, nick, hostmask string, words int) error {
-	return m.db.Update(func(tx *bolt.Tx) error {
-		root := tx.Bucket([]byte(statsRootBucket))
-		chanBucket, err := root.CreateBucketIfNotExists([]byte(channel))
-		if err != nil {
-			return err
-		}
-		statsBytes := chanBucket.Get([]byte(nick))
-		if statsBytes == nil {
-			insert := ChannelStats{
+	var c ChannelStats
+	return m.store.Collection(channel, storage.JSON).Update(nick, &c, func(found bool) error {
+		if !found {
+			c = ChannelStats{
 				Nick:     nick,
 				Channel:  channel,
 				Hostmask: hostmask,
-				Words:    words,
 			}
-			enc, err := json.Marshal(insert)
-			if err != nil {
-				return err
-			}
-			return chanBucket.Put([]byte(nick), enc)
-		}
-		var c ChannelStats
-		err = json.Unmarshal(statsBytes, &c)
-		if err != nil {
-			return err
 		}
 		c.Words = c.Words + words
-		enc, err := json.Marshal(c)
-		if err != nil {
-			return err
-		}
-		return chanBucket.Put([]byte(nick), enc)
+		return nil
 	})
 }
 
 func (m *StatsModule) selectWordStats(channel string) (output string, output2 string, err error) {
 	stats := make([]ChannelStats, 0)
-	err = m.db.View(func(tx *bolt.Tx) error {
-		chanBucket := tx.Bucket([]byte(statsRootBucket)).Bucket([]byte(channel))
-		if chanBucket == nil {
+	err = m.store.Collection(channel, storage.JSON).Iterate(func(nick string, decode func(v interface{}) error) error {
+		var cs ChannelStats
+		if err := decode(&cs); err != nil {
+			m.log.Errorf("invalid stats of %s on %s: %v", nick, channel, err)
 			return nil
 		}
-		c := chanBucket.Cursor()
-		for k, v := c.First(); k != nil; k, v = c.Next() {
-			var cs ChannelStats
-			err = json.Unmarshal(v, &cs)
-			if err != nil {
-				continue
-			}
-			stats = append(stats, cs)
-		}
+		stats = append(stats, cs)
 		return nil
 	})
 	if err != nil {
@@ -7,7 +7,6 @@ import (
 
 	"github.com/gocolly/colly/v2"
 	"github.com/huqa/gofibot/internal/pkg/logger"
-	"github.com/lrstanley/girc"
 )
 
 const userAgent string = "Mozilla/5.0 (Linux; Android 7.1.2; DSCS9 Build/NHG47L; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/80.0.3987.149 Safari/537.36"
@@ -33,13 +32,16 @@ var youtubeURLs = map[string]string{
 }
 
 // NewURLTitleModule constructs new URLTitleModule
-func NewURLTitleModule(log logger.Logger, client *girc.Client) *URLTitleModule {
+func NewURLTitleModule(log logger.Logger, responder Responder) *URLTitleModule {
 	return &URLTitleModule{
 		&Module{
-			log:    log.Named("urltitlemodule"),
-			client: client,
-			global: true,
-			event:  "PRIVMSG",
+			name:        "urltitle",
+			log:         log.Named("urltitlemodule"),
+			responder:   responder,
+			global:      true,
+			events:      []string{EventPrivmsg},
+			contexts:    ContextAll,
+			description: "shows titles of links posted on channels",
 		},
 		nil,
 		nil,
@@ -79,17 +81,17 @@ func (m *URLTitleModule) Stop() error {
 	return nil
 }
 
-// Run shouts url titles to PRIVMSG in target channel
+// Handle shouts url titles to PRIVMSG in target channel
 // TODO: imdb url support
-func (m *URLTitleModule) Run(channel, hostmask, user, command string, args []string) error {
+func (m *URLTitleModule) Handle(c *Context) error {
 	//message := strings.Join(args, " ")
-	for _, message := range args {
+	for _, message := range c.Args {
 		URL, err := url.Parse(message)
 		if err != nil {
 			continue
 		}
 		ctx := colly.NewContext()
-		ctx.Put("Channel", channel)
+		ctx.Put("Channel", c.Target)
 		// youtube urls have their own collector
 		if _, ok := youtubeURLs[URL.Hostname()]; ok {
 			headers := map[string][]string{
@@ -104,14 +106,29 @@ func (m *URLTitleModule) Run(channel, hostmask, user, command string, args []str
 	return nil
 }
 
+// Name returns the name of this module
+func (m *URLTitleModule) Name() string {
+	return m.name
+}
+
 // Commands returns all commands used by this module
 func (m *URLTitleModule) Commands() []string {
 	return m.commands
 }
 
-// Event returns event type used by this module
-func (m *URLTitleModule) Event() string {
-	return m.event
+// Description returns what this module does
+func (m *URLTitleModule) Description() string {
+	return m.description
+}
+
+// Help returns help for commands of this module
+func (m *URLTitleModule) Help() []CommandHelp {
+	return m.help
+}
+
+// Events returns event types used by this module
+func (m *URLTitleModule) Events() []string {
+	return m.events
 }
 
 // Global returns true if this module is a global command
@@ -119,15 +136,21 @@ func (m *URLTitleModule) Global() bool {
 	return m.global
 }
 
-func (m *URLTitleModule) Schedule() (bool, time.Time, time.Duration) {
-	return false, time.Time{}, 0
+// Contexts returns where this module accepts messages from
+func (m *URLTitleModule) Contexts() MessageContext {
+	return m.contexts
+}
+
+// Cooldown returns how often a user may run commands of this module
+func (m *URLTitleModule) Cooldown() time.Duration {
+	return m.cooldown
 }
 
 func (m *URLTitleModule) URLTitleCallback(e *colly.HTMLElement) {
 	if e.Index == 0 {
 		channel := e.Response.Ctx.Get("Channel")
 		title := URLTitle(strings.TrimSpace(e.Text))
-		m.client.Cmd.Message(channel, "Title: "+string(title))
+		m.responder.Message(channel, "Title: "+string(title))
 	}
 	return
 }
@@ -136,7 +159,7 @@ func (m *URLTitleModule) YTTitleCallback(e *colly.HTMLElement) {
 	if e.Index == 0 {
 		channel := e.Response.Ctx.Get("Channel")
 		title := URLTitle(strings.TrimSpace(e.Attr("content")) + " - YouTube")
-		m.client.Cmd.Message(channel, "Title: "+string(title))
+		m.responder.Message(channel, "Title: "+string(title))
 	}
 	return
 }
@@ -6,8 +6,8 @@ import (
 	"time"
 
 	"github.com/gocolly/colly"
+	"github.com/huqa/gofibot/internal/pkg/cmdline"
 	"github.com/huqa/gofibot/internal/pkg/logger"
-	"github.com/lrstanley/girc"
 )
 
 // WeatherModule fetches weather from an outside service
@@ -30,13 +30,28 @@ type WeatherData struct {
 }
 
 // NewWeatherModule constructs new WeatherModule
-func NewWeatherModule(log logger.Logger, client *girc.Client) *WeatherModule {
+func NewWeatherModule(log logger.Logger, responder Responder) *WeatherModule {
 	return &WeatherModule{
 		&Module{
-			log:      log.Named("weathermodule"),
-			commands: []string{"w", "sää", "saa"},
-			client:   client,
-			event:    "PRIVMSG",
+			name:        "weather",
+			log:         log.Named("weathermodule"),
+			commands:    []string{"w", "sää", "saa"},
+			responder:   responder,
+			events:      []string{EventPrivmsg},
+			contexts:    ContextAll,
+			cooldown:    10 * time.Second,
+			description: "fetches weather from wttr.in",
+			help: []CommandHelp{
+				{
+					Command:     "w",
+					Aliases:     []string{"sää", "saa"},
+					Description: "shows the current weather of a location, defaults to tampere",
+					Args: &cmdline.Spec{
+						Args: []cmdline.Arg{{Name: "location", Optional: true, Variadic: true}},
+					},
+					Examples: []string{"w helsinki", "w tampere"},
+				},
+			},
 		},
 		nil,
 		"http://wttr.in/%s",
@@ -58,7 +73,7 @@ func (m *WeatherModule) Init() error {
 	c.OnError(func(r *colly.Response, err error) {
 		m.log.Error("error: ", r.StatusCode, err)
 		channel := r.Ctx.Get("Channel")
-		m.client.Cmd.Message(channel, "!w - internet says: error no bonus")
+		m.responder.Message(channel, "!w - internet says: error no bonus")
 	})
 	m.weatherCollector = c
 	return nil
@@ -69,8 +84,9 @@ func (m *WeatherModule) Stop() error {
 	return nil
 }
 
-// Run sends weather data to PRIVMSG target channel
-func (m *WeatherModule) Run(channel, hostmask, user, command string, args []string) error {
+// Handle sends weather data to PRIVMSG target channel
+func (m *WeatherModule) Handle(c *Context) error {
+	args := c.Args
 	if len(args) == 0 {
 		args = append(args, "tampere")
 	}
@@ -81,20 +97,35 @@ func (m *WeatherModule) Run(channel, hostmask, user, command string, args []stri
 	weatherURL := fmt.Sprintf(m.url, message)
 	weatherURL += m.weatherOptions
 	ctx := colly.NewContext()
-	ctx.Put("Channel", channel)
+	ctx.Put("Channel", c.Target)
 	m.weatherCollector.Request("GET", weatherURL, nil, ctx, nil)
 
 	return nil
 }
 
+// Name returns the name of this module
+func (m *WeatherModule) Name() string {
+	return m.name
+}
+
 // Commands return all commands used by the module
 func (m *WeatherModule) Commands() []string {
 	return m.commands
 }
 
-// Event returns event type used by this module
-func (m *WeatherModule) Event() string {
-	return m.event
+// Description returns what this module does
+func (m *WeatherModule) Description() string {
+	return m.description
+}
+
+// Help returns help for commands of this module
+func (m *WeatherModule) Help() []CommandHelp {
+	return m.help
+}
+
+// Events returns event types used by this module
+func (m *WeatherModule) Events() []string {
+	return m.events
 }
 
 // Global returns true if this module is a global command
@@ -102,26 +133,31 @@ func (m *WeatherModule) Global() bool {
 	return m.global
 }
 
-// Schedule schedules this module to be run at specific intervals
-func (m *WeatherModule) Schedule() (bool, time.Time, time.Duration) {
-	return false, time.Time{}, 0
+// Contexts returns where this module accepts messages from
+func (m *WeatherModule) Contexts() MessageContext {
+	return m.contexts
+}
+
+// Cooldown returns how often a user may run commands of this module
+func (m *WeatherModule) Cooldown() time.Duration {
+	return m.cooldown
 }
 
 func (m *WeatherModule) weatherResponseCallback(r *colly.Response) {
 	channel := r.Ctx.Get("Channel")
 	if r.StatusCode != 200 {
-		m.client.Cmd.Message(channel, "!w - weather service error")
+		m.responder.Message(channel, "!w - weather service error")
 		return
 	}
 	var body = string(r.Body)
 	if strings.HasPrefix(body, "<html>") {
-		m.client.Cmd.Message(channel, "!w - weather service error")
+		m.responder.Message(channel, "!w - weather service error")
 		return
 	}
 
 	var wd = strings.Split(body, ",")
 	if len(wd) < 6 {
-		m.client.Cmd.Message(channel, "!w - weather service error")
+		m.responder.Message(channel, "!w - weather service error")
 		return
 	}
 	var loc string
@@ -149,5 +185,5 @@ func (m *WeatherModule) weatherResponseCallback(r *colly.Response) {
 		data.Wind,
 		data.Precipitation,
 	)
-	m.client.Cmd.Message(channel, wString)
+	m.responder.Message(channel, wString)
 }
@@ -4,10 +4,23 @@ package proc
 import (
 	"os"
 	"os/signal"
+	"syscall"
 )
 
-func WaitForInterrupt() {
+// NotifyInterrupt returns a channel that receives interrupt signals
+func NotifyInterrupt() <-chan os.Signal {
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
-	<-stop
+	return stop
+}
+
+// NotifyHangup returns a channel that receives hangup signals
+func NotifyHangup() <-chan os.Signal {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	return hup
+}
+
+func WaitForInterrupt() {
+	<-NotifyInterrupt()
 }
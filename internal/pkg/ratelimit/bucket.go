@@ -0,0 +1,71 @@
+// Package ratelimit provides token buckets for limiting message rates
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// TokenBucket allows Burst events at once and refills at Rate tokens per
+// second. It is not safe for concurrent use.
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket constructs a full TokenBucket
+func NewTokenBucket(rate float64, burst int, now time.Time) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// Wait returns how long until a token is available, zero if one is
+// available now
+func (b *TokenBucket) Wait(now time.Time) time.Duration {
+	b.refill(now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	if b.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Allow takes a token if one is available
+func (b *TokenBucket) Allow(now time.Time) bool {
+	if b.Wait(now) > 0 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Take takes a token, callers should check Wait first
+func (b *TokenBucket) Take(now time.Time) {
+	b.refill(now)
+	b.tokens--
+}
+
+// Full returns true if the bucket has refilled completely and can be
+// discarded
+func (b *TokenBucket) Full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
@@ -0,0 +1,63 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	// one token every 500ms, three at once
+	b := NewTokenBucket(2, 3, start)
+
+	for i := 0; i < 3; i++ {
+		if !b.Allow(start) {
+			t.Fatalf("burst token %d was not allowed", i+1)
+		}
+	}
+	if b.Allow(start) {
+		t.Fatal("allowed more than the burst")
+	}
+	if wait := b.Wait(start); wait != 500*time.Millisecond {
+		t.Errorf("Wait after the burst = %s, want 500ms", wait)
+	}
+	if wait := b.Wait(start.Add(200 * time.Millisecond)); wait != 300*time.Millisecond {
+		t.Errorf("Wait after 200ms = %s, want 300ms", wait)
+	}
+	if !b.Allow(start.Add(500 * time.Millisecond)) {
+		t.Error("token was not refilled after 500ms")
+	}
+	if b.Full(start.Add(time.Second)) {
+		t.Error("bucket is full after refilling one token")
+	}
+	// refilling stops at the burst
+	if !b.Full(start.Add(time.Hour)) {
+		t.Error("bucket is not full after an hour")
+	}
+	for i := 0; i < 3; i++ {
+		b.Take(start.Add(time.Hour))
+	}
+	if b.Allow(start.Add(time.Hour)) {
+		t.Error("refilled more than the burst")
+	}
+}
+
+func TestTokenBucketMinimumBurst(t *testing.T) {
+	now := time.Now()
+	b := NewTokenBucket(1, 0, now)
+	if !b.Allow(now) {
+		t.Error("a bucket without burst does not allow one token")
+	}
+	if b.Allow(now) {
+		t.Error("a bucket without burst allows two tokens")
+	}
+}
+
+func TestTokenBucketZeroRate(t *testing.T) {
+	now := time.Now()
+	b := NewTokenBucket(0, 1, now)
+	b.Take(now)
+	if wait := b.Wait(now.Add(time.Hour)); wait <= time.Hour {
+		t.Errorf("a bucket without rate refilled, Wait = %s", wait)
+	}
+}
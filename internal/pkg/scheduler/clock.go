@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to a Scheduler. Replace it to control time in
+// tests and offline runs.
+type Clock interface {
+	Now() time.Time
+	// Wait sends the time on the returned channel once it is at least
+	// until, nothing is sent if stop is closed first
+	Wait(until time.Time, stop <-chan struct{}) <-chan time.Time
+}
+
+type realClock struct{}
+
+// RealClock returns the system clock
+func RealClock() Clock {
+	return realClock{}
+}
+
+// Now returns the current time
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Wait waits on a timer that is released when stop is closed
+func (realClock) Wait(until time.Time, stop <-chan struct{}) <-chan time.Time {
+	c := make(chan time.Time, 1)
+	timer := time.NewTimer(time.Until(until))
+	go func() {
+		defer timer.Stop()
+		select {
+		case t := <-timer.C:
+			c <- t
+		case <-stop:
+		}
+	}()
+	return c
+}
+
+// FakeClock is a Clock that only moves when told to
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	until time.Time
+	stop  <-chan struct{}
+	c     chan time.Time
+}
+
+// NewFakeClock constructs a FakeClock set to now
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the time of the clock
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Wait fires when the clock is set to until or later
+func (f *FakeClock) Wait(until time.Time, stop <-chan struct{}) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := fakeWaiter{until: until, stop: stop, c: make(chan time.Time, 1)}
+	if !until.After(f.now) {
+		w.c <- f.now
+		return w.c
+	}
+	f.waiters = append(f.waiters, w)
+	return w.c
+}
+
+// Advance moves the clock forward by d
+func (f *FakeClock) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set sets the clock to now and fires the waits that are due
+func (f *FakeClock) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+	waiting := f.waiters[:0]
+	for _, w := range f.waiters {
+		select {
+		case <-w.stop:
+			continue
+		default:
+		}
+		if w.until.After(now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.c <- now
+	}
+	f.waiters = waiting
+}
@@ -0,0 +1,225 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns the next time a job runs after t
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// maxSearchYears limits the search for the next run of schedules that
+// rarely or never match, e.g. "0 0 30 2 *"
+const maxSearchYears int = 5
+
+// cronSchedule is a parsed five field cron expression. Fields are sets of
+// allowed values indexed by value.
+type cronSchedule struct {
+	minutes  []bool
+	hours    []bool
+	days     []bool
+	months   []bool
+	weekdays []bool
+	// cron runs a job when either the day of month or the weekday matches
+	// if both are restricted
+	anyDay     bool
+	anyWeekday bool
+	location   *time.Location
+}
+
+// every runs a job at a fixed interval
+type every struct {
+	interval time.Duration
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Parse parses a cron expression evaluated in location. It accepts the
+// five fields minute, hour, day of month, month and day of week with
+// lists, ranges, steps and month and weekday names, the descriptors
+// @yearly, @monthly, @weekly, @daily and @hourly, and "@every <duration>".
+func Parse(spec string, location *time.Location) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(spec[len("@every "):]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval in %q: %v", spec, err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("interval in %q is shorter than a second", spec)
+		}
+		return every{interval}, nil
+	}
+	if expr, ok := descriptors[spec]; ok {
+		spec = expr
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in %q, got %d", spec, len(fields))
+	}
+	s := &cronSchedule{
+		anyDay:     fields[2] == "*" || fields[2] == "?",
+		anyWeekday: fields[4] == "*" || fields[4] == "?",
+		location:   location,
+	}
+	var err error
+	if s.minutes, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("minute: %v", err)
+	}
+	if s.hours, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("hour: %v", err)
+	}
+	if s.days, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("day of month: %v", err)
+	}
+	if s.months, err = parseField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("month: %v", err)
+	}
+	if s.weekdays, err = parseField(fields[4], 0, 7, weekdayNames); err != nil {
+		return nil, fmt.Errorf("day of week: %v", err)
+	}
+	// both 0 and 7 are sunday
+	s.weekdays[0] = s.weekdays[0] || s.weekdays[7]
+	return s, nil
+}
+
+// parseField parses a comma separated list of values, ranges and steps
+func parseField(field string, min, max int, names map[string]int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if slash := strings.IndexByte(part, '/'); slash >= 0 {
+			n, err := strconv.Atoi(part[slash+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+			part = part[:slash]
+		}
+		lo, hi := min, max
+		switch {
+		case part == "*" || part == "?":
+		case strings.IndexByte(part, '-') > 0:
+			dash := strings.IndexByte(part, '-')
+			var err error
+			if lo, err = parseValue(part[:dash], min, max, names); err != nil {
+				return nil, err
+			}
+			if hi, err = parseValue(part[dash+1:], min, max, names); err != nil {
+				return nil, err
+			}
+			if lo > hi {
+				return nil, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			v, err := parseValue(part, min, max, names)
+			if err != nil {
+				return nil, err
+			}
+			lo = v
+			// "5/10" means every 10th from 5
+			if step == 1 {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func parseValue(s string, min, max int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("%d is not within %d-%d", v, min, max)
+	}
+	return v, nil
+}
+
+// Next returns the first matching wall clock time after t. Times that
+// don't exist because of a daylight saving change are skipped and times
+// that happen twice run once, at their first occurrence.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.location)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+	end := t.AddDate(maxSearchYears, 0, 0)
+	for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+		y, m, d := day.Date()
+		if !s.matchDay(day) {
+			continue
+		}
+		for h, okHour := range s.hours {
+			if !okHour {
+				continue
+			}
+			for min, okMinute := range s.minutes {
+				if !okMinute {
+					continue
+				}
+				next := time.Date(y, m, d, h, min, 0, 0, s.location)
+				if next.Hour() != h || next.Minute() != min {
+					// does not exist on this day
+					continue
+				}
+				if earlier := next.Add(-time.Hour); earlier.Hour() == h && earlier.Minute() == min {
+					// happens twice on this day, time.Date may return either
+					next = earlier
+				}
+				if next.After(t) {
+					return next
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) matchDay(day time.Time) bool {
+	if !s.months[int(day.Month())] {
+		return false
+	}
+	dayOk := s.days[day.Day()]
+	weekdayOk := s.weekdays[int(day.Weekday())]
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekdayOk
+	case s.anyWeekday:
+		return dayOk
+	}
+	return dayOk || weekdayOk
+}
+
+// Next returns t plus the interval
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(e.interval)
+}
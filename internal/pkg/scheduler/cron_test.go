@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func helsinki(t *testing.T) *time.Location {
+	t.Helper()
+	location, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	return location
+}
+
+func TestParseInvalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"-5 * * * *",
+		"a * * * *",
+		"* * * foo *",
+		"1,,2 * * * *",
+		"@every",
+		"@every x",
+		"@every 500ms",
+		"@fortnightly",
+	}
+	for _, spec := range specs {
+		if _, err := Parse(spec, time.UTC); err == nil {
+			t.Errorf("Parse(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		spec string
+		from time.Time
+		want []time.Time
+	}{
+		{"0 0 * * *", utc(10, 18, 12, 0), []time.Time{utc(10, 19, 0, 0), utc(10, 20, 0, 0)}},
+		{"@daily", utc(10, 18, 0, 0), []time.Time{utc(10, 19, 0, 0)}},
+		{"@hourly", utc(10, 18, 12, 30), []time.Time{utc(10, 18, 13, 0), utc(10, 18, 14, 0)}},
+		{"0,30 12 * * *", utc(10, 18, 0, 0), []time.Time{utc(10, 18, 12, 0), utc(10, 18, 12, 30), utc(10, 19, 12, 0)}},
+		{"*/20 9-10 * * *", utc(10, 18, 10, 30), []time.Time{utc(10, 18, 10, 40), utc(10, 19, 9, 0), utc(10, 19, 9, 20)}},
+		{"5/25 * * * *", utc(10, 18, 10, 0), []time.Time{utc(10, 18, 10, 5), utc(10, 18, 10, 30), utc(10, 18, 10, 55), utc(10, 18, 11, 5)}},
+		// 2026-10-18 is a sunday
+		{"0 8 * * mon-fri", utc(10, 16, 9, 0), []time.Time{utc(10, 19, 8, 0), utc(10, 20, 8, 0)}},
+		{"0 8 * * 6-7", utc(10, 16, 9, 0), []time.Time{utc(10, 17, 8, 0), utc(10, 18, 8, 0), utc(10, 24, 8, 0)}},
+		{"0 0 * * 0", utc(10, 17, 0, 0), []time.Time{utc(10, 18, 0, 0)}},
+		{"0 0 1,15 * *", utc(10, 2, 0, 0), []time.Time{utc(10, 15, 0, 0), utc(11, 1, 0, 0)}},
+		{"0 12 1 jan,jul *", utc(3, 1, 0, 0), []time.Time{utc(7, 1, 12, 0), time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC)}},
+		// day of month or weekday when both are restricted
+		{"0 0 20 * fri", utc(10, 18, 0, 0), []time.Time{utc(10, 20, 0, 0), utc(10, 23, 0, 0), utc(10, 30, 0, 0)}},
+		{"@every 90m", utc(10, 18, 0, 0), []time.Time{utc(10, 18, 1, 30), utc(10, 18, 3, 0)}},
+		// never matches
+		{"0 0 30 2 *", utc(1, 1, 0, 0), []time.Time{{}}},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec, time.UTC)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		from := tt.from
+		for _, want := range tt.want {
+			got := s.Next(from)
+			if !got.Equal(want) {
+				t.Errorf("%q: Next(%s) = %s, want %s", tt.spec, from, got, want)
+				break
+			}
+			from = got
+		}
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	location := helsinki(t)
+	local := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, location)
+	}
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	// clocks go from 03:00 EET to 04:00 EEST on 2026-03-29 and from
+	// 04:00 EEST back to 03:00 EET on 2026-10-25
+	tests := []struct {
+		name string
+		spec string
+		from time.Time
+		want []time.Time
+	}{
+		{
+			"daily before spring forward keeps the wall clock time",
+			"0 2 * * *", local(3, 28, 2, 0),
+			[]time.Time{utc(3, 29, 0, 0), utc(3, 29, 23, 0)},
+		},
+		{
+			"missing time is skipped on spring forward",
+			"30 3 * * *", local(3, 28, 12, 0),
+			[]time.Time{utc(3, 30, 0, 30)},
+		},
+		{
+			"hourly skips the missing hour",
+			"0 * * * *", utc(3, 29, 0, 30),
+			[]time.Time{utc(3, 29, 1, 0), utc(3, 29, 2, 0)},
+		},
+		{
+			"repeated time runs once on fall back",
+			"30 3 * * *", local(10, 25, 0, 0),
+			[]time.Time{utc(10, 25, 0, 30), utc(10, 26, 1, 30)},
+		},
+		{
+			"hourly runs the repeated hour once",
+			"0 * * * *", utc(10, 24, 23, 30),
+			[]time.Time{utc(10, 25, 0, 0), utc(10, 25, 2, 0), utc(10, 25, 3, 0)},
+		},
+		{
+			"midnight after fall back",
+			"@midnight", local(10, 24, 12, 0),
+			[]time.Time{utc(10, 24, 21, 0), utc(10, 25, 22, 0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.spec, location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := tt.from
+			for _, want := range tt.want {
+				got := s.Next(from)
+				if !got.Equal(want) {
+					t.Fatalf("Next(%s) = %s, want %s", from, got, want.In(location))
+				}
+				if got.Location() != location {
+					t.Errorf("Next(%s) is in %s, want %s", from, got.Location(), location)
+				}
+				from = got
+			}
+		})
+	}
+}
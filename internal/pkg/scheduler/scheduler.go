@@ -0,0 +1,272 @@
+// Package scheduler runs named jobs on cron schedules
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/logger"
+)
+
+// idleWait is how long the scheduler sleeps when it has no jobs
+const idleWait = 24 * time.Hour
+
+// Func is the work of a job, scheduled is the time the run was due
+type Func func(scheduled time.Time)
+
+// Entry describes a scheduled job
+type Entry struct {
+	Name    string
+	Spec    string
+	Next    time.Time
+	LastRun time.Time
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	catchUp  bool
+	run      Func
+	next     time.Time
+	lastRun  time.Time
+}
+
+// Scheduler runs jobs when their schedules are due. Last run times are
+// saved to a Store and jobs that allow it are run at start if their last
+// run was missed, e.g. while the bot was down.
+type Scheduler struct {
+	log      logger.Logger
+	location *time.Location
+	clock    Clock
+	store    Store
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	active  map[string]bool
+	started bool
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	running sync.WaitGroup
+}
+
+// New constructs a Scheduler evaluating schedules in location
+func New(log logger.Logger, location *time.Location, clock Clock, store Store) *Scheduler {
+	return &Scheduler{
+		log:      log.Named("scheduler"),
+		location: location,
+		clock:    clock,
+		store:    store,
+		jobs:     make(map[string]*job),
+		active:   make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Add adds a job called name running run on the cron schedule spec. With
+// catchUp a missed run is done when the scheduler starts. Adding a job
+// with the name of an existing job replaces it.
+func (s *Scheduler) Add(name, spec string, catchUp bool, run Func) error {
+	schedule, err := Parse(spec, s.location)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for %s: %v", name, err)
+	}
+	j := &job{
+		name:     name,
+		spec:     spec,
+		schedule: schedule,
+		catchUp:  catchUp,
+		run:      run,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[name] = j
+	if s.started {
+		s.prepare(j, s.clock.Now())
+		s.signal()
+	}
+	return nil
+}
+
+// Remove removes the job called name
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, name)
+	s.signal()
+}
+
+// SetClock replaces the clock of the scheduler, it must be called
+// before Start
+func (s *Scheduler) SetClock(clock Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clock
+}
+
+// Start starts running jobs, a stopped scheduler can be started again
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started {
+		return
+	}
+	s.started = true
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	now := s.clock.Now()
+	for _, j := range s.jobs {
+		s.prepare(j, now)
+	}
+	go s.loop(s.stop, s.done)
+}
+
+// prepare loads the last run of j, catches up a missed run and sets the
+// next run. Must be called with mu held.
+func (s *Scheduler) prepare(j *job, now time.Time) {
+	lastRun, ok, err := s.store.LastRun(j.name)
+	if err != nil {
+		s.log.Errorf("can't load last run of %s: %v", j.name, err)
+	}
+	if !ok {
+		// runs missed from now on can be caught up
+		lastRun = now
+		if err := s.store.SetLastRun(j.name, now); err != nil {
+			s.log.Errorf("can't save last run of %s: %v", j.name, err)
+		}
+	}
+	j.lastRun = lastRun
+	j.next = j.schedule.Next(now)
+	if missed := j.schedule.Next(lastRun); j.catchUp && !missed.IsZero() && !missed.After(now) {
+		s.log.Infof("catching up %s missed at %s", j.name, missed)
+		s.runJob(j, missed)
+	}
+}
+
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) loop(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		next := s.nextRun(s.clock.Now())
+		cancel := make(chan struct{})
+		select {
+		case <-s.clock.Wait(next, cancel):
+		case <-s.wake:
+		case <-stop:
+			close(cancel)
+			return
+		}
+		close(cancel)
+		s.runDue(s.clock.Now())
+	}
+}
+
+// nextRun returns when the next job is due
+func (s *Scheduler) nextRun(now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var next time.Time
+	for _, j := range s.jobs {
+		if !j.next.IsZero() && (next.IsZero() || j.next.Before(next)) {
+			next = j.next
+		}
+	}
+	if next.IsZero() {
+		return now.Add(idleWait)
+	}
+	return next
+}
+
+func (s *Scheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.next.IsZero() || j.next.After(now) {
+			continue
+		}
+		s.runJob(j, j.next)
+		j.next = j.schedule.Next(now)
+	}
+}
+
+// runJob runs j in its own goroutine and saves the run. A run is skipped
+// while the previous run of a job with the same name is still going.
+// Must be called with mu held.
+func (s *Scheduler) runJob(j *job, scheduled time.Time) {
+	if s.active[j.name] {
+		s.log.Infof("skipping %s at %s, the previous run is still going", j.name, scheduled)
+		return
+	}
+	s.active[j.name] = true
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		ok := s.run(j, scheduled)
+		if ok {
+			if err := s.store.SetLastRun(j.name, scheduled); err != nil {
+				s.log.Errorf("can't save last run of %s: %v", j.name, err)
+			}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if ok {
+			j.lastRun = scheduled
+		}
+		delete(s.active, j.name)
+	}()
+}
+
+// run runs j and returns false if it panicked
+func (s *Scheduler) run(j *job, scheduled time.Time) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.log.Errorf("job %s panicked: %v", j.name, r)
+			ok = false
+		}
+	}()
+	j.run(scheduled)
+	return true
+}
+
+// Stop stops running jobs and waits for running jobs to finish
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	started := s.started
+	s.started = false
+	stop, done := s.stop, s.done
+	s.mu.Unlock()
+	if !started {
+		return
+	}
+	close(stop)
+	<-done
+	s.running.Wait()
+}
+
+// Entries returns the jobs sorted by name
+func (s *Scheduler) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]Entry, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		entries = append(entries, Entry{
+			Name:    j.name,
+			Spec:    j.spec,
+			Next:    j.next,
+			LastRun: j.lastRun,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries
+}
@@ -0,0 +1,184 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/huqa/gofibot/internal/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// memoryStore keeps last runs in memory
+type memoryStore struct {
+	mu       sync.Mutex
+	lastRuns map[string]time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{lastRuns: make(map[string]time.Time)}
+}
+
+func (s *memoryStore) LastRun(job string) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.lastRuns[job]
+	return t, ok, nil
+}
+
+func (s *memoryStore) SetLastRun(job string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastRuns[job] = t
+	return nil
+}
+
+func newTestScheduler(location *time.Location, clock Clock, store Store) *Scheduler {
+	log := &logger.LogWrapper{SugaredLogger: zap.NewNop().Sugar()}
+	return New(log, location, clock, store)
+}
+
+// recorder returns a job recording its scheduled times to runs
+func recorder(runs chan time.Time) Func {
+	return func(scheduled time.Time) {
+		runs <- scheduled
+	}
+}
+
+func expectRun(t *testing.T, runs chan time.Time, want time.Time) {
+	t.Helper()
+	select {
+	case got := <-runs:
+		if !got.Equal(want) {
+			t.Errorf("ran for %s, want %s", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("did not run for %s", want)
+	}
+}
+
+func expectNoRun(t *testing.T, runs chan time.Time) {
+	t.Helper()
+	select {
+	case got := <-runs:
+		t.Errorf("ran for %s", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	location := helsinki(t)
+	// the bot was down over midnight
+	lastRun := time.Date(2026, 10, 17, 0, 0, 0, 0, location)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, location)
+	store := newMemoryStore()
+	store.SetLastRun("daily", lastRun)
+	store.SetLastRun("nocatchup", lastRun)
+	store.SetLastRun("recent", now.Add(-time.Hour))
+
+	clock := NewFakeClock(now)
+	s := newTestScheduler(location, clock, store)
+	daily := make(chan time.Time, 10)
+	noCatchUp := make(chan time.Time, 10)
+	recent := make(chan time.Time, 10)
+	newJob := make(chan time.Time, 10)
+	s.Add("daily", "0 0 * * *", true, recorder(daily))
+	s.Add("nocatchup", "0 0 * * *", false, recorder(noCatchUp))
+	s.Add("recent", "0 0 * * *", true, recorder(recent))
+	s.Add("new", "0 0 * * *", true, recorder(newJob))
+	s.Start()
+	defer s.Stop()
+
+	// only the latest missed run is caught up
+	midnight := time.Date(2026, 10, 18, 0, 0, 0, 0, location)
+	expectRun(t, daily, midnight)
+	expectNoRun(t, daily)
+	expectNoRun(t, noCatchUp)
+	expectNoRun(t, recent)
+	// jobs without a last run start counting from now
+	expectNoRun(t, newJob)
+	if got, _, _ := store.LastRun("new"); !got.Equal(now) {
+		t.Errorf("last run of a new job is %s, want %s", got, now)
+	}
+
+	next := midnight.AddDate(0, 0, 1)
+	clock.Set(next)
+	for _, runs := range []chan time.Time{daily, noCatchUp, recent, newJob} {
+		expectRun(t, runs, next)
+	}
+	s.Stop()
+	if got, _, _ := store.LastRun("daily"); !got.Equal(next) {
+		t.Errorf("saved last run %s, want %s", got, next)
+	}
+}
+
+func TestAddWhileRunning(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(now)
+	s := newTestScheduler(time.UTC, clock, newMemoryStore())
+	s.Start()
+	defer s.Stop()
+
+	runs := make(chan time.Time, 10)
+	if err := s.Add("minutely", "* * * * *", false, recorder(runs)); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	expectRun(t, runs, now.Add(time.Minute))
+
+	s.Remove("minutely")
+	clock.Advance(time.Minute)
+	expectNoRun(t, runs)
+
+	if err := s.Add("invalid", "* * *", false, recorder(runs)); err == nil {
+		t.Error("added a job with an invalid schedule")
+	}
+}
+
+func TestRestart(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(now)
+	s := newTestScheduler(time.UTC, clock, newMemoryStore())
+	runs := make(chan time.Time, 10)
+	s.Add("minutely", "* * * * *", false, recorder(runs))
+
+	s.Stop()
+	s.Start()
+	s.Stop()
+	s.Stop()
+	s.Start()
+	defer s.Stop()
+
+	clock.Advance(time.Minute)
+	expectRun(t, runs, now.Add(time.Minute))
+}
+
+func TestSkipWhileRunning(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(now)
+	s := newTestScheduler(time.UTC, clock, newMemoryStore())
+	runs := make(chan time.Time, 10)
+	release := make(chan struct{})
+	s.Add("slow", "* * * * *", false, func(scheduled time.Time) {
+		runs <- scheduled
+		<-release
+	})
+	s.Start()
+	defer s.Stop()
+
+	clock.Advance(time.Minute)
+	expectRun(t, runs, now.Add(time.Minute))
+	clock.Advance(time.Minute)
+	expectNoRun(t, runs)
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for !s.Entries()[0].LastRun.Equal(now.Add(time.Minute)) {
+		if time.Now().After(deadline) {
+			t.Fatal("the slow run did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	expectRun(t, runs, now.Add(3*time.Minute))
+}
@@ -0,0 +1,61 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const lastRunBucket string = "Schedule"
+
+// Store keeps the last run times of jobs so missed runs can be caught up
+// after a restart
+type Store interface {
+	LastRun(job string) (time.Time, bool, error)
+	SetLastRun(job string, t time.Time) error
+}
+
+// boltStore stores last run times in bbolt
+type boltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore constructs a Store saving to db
+func NewBoltStore(db *bolt.DB) (Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(lastRunBucket))
+		if err != nil {
+			return fmt.Errorf("could not create schedule bucket: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db}, nil
+}
+
+// LastRun returns when job last ran
+func (s *boltStore) LastRun(job string) (t time.Time, ok bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(lastRunBucket)).Get([]byte(job))
+		if v == nil {
+			return nil
+		}
+		ok = true
+		return t.UnmarshalText(v)
+	})
+	return t, ok, err
+}
+
+// SetLastRun saves when job last ran
+func (s *boltStore) SetLastRun(job string, t time.Time) error {
+	v, err := t.MarshalText()
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(lastRunBucket)).Put([]byte(job), v)
+	})
+}
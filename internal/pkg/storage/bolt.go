@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltDB runs transactions on db or, if set, in tx
+type boltDB struct {
+	db *bolt.DB
+	tx *bolt.Tx
+}
+
+func (b boltDB) view(fn func(tx *bolt.Tx) error) error {
+	if b.tx != nil {
+		return fn(b.tx)
+	}
+	return b.db.View(fn)
+}
+
+func (b boltDB) update(fn func(tx *bolt.Tx) error) error {
+	if b.tx != nil {
+		return fn(b.tx)
+	}
+	return b.db.Update(fn)
+}
+
+// boltNamespace stores namespaces and collections as nested bbolt buckets
+type boltNamespace struct {
+	boltDB
+	path []string
+}
+
+// NewBolt returns the root namespace of db, namespaces and collections
+// in it are top level buckets
+func NewBolt(db *bolt.DB) Namespace {
+	return &boltNamespace{boltDB: boltDB{db: db}}
+}
+
+// NewBoltTx returns the root namespace of db as seen by tx, everything
+// is read and written in tx
+func NewBoltTx(tx *bolt.Tx) Namespace {
+	return &boltNamespace{boltDB: boltDB{tx: tx}}
+}
+
+// Namespace returns the nested namespace called name
+func (n *boltNamespace) Namespace(name string) Namespace {
+	return &boltNamespace{boltDB: n.boltDB, path: appendPath(n.path, name)}
+}
+
+// Collection returns the collection called name
+func (n *boltNamespace) Collection(name string, codec Codec) Collection {
+	return &boltCollection{boltDB: n.boltDB, path: appendPath(n.path, name), codec: codec}
+}
+
+// Drop deletes the bucket called name
+func (n *boltNamespace) Drop(name string) error {
+	return n.update(func(tx *bolt.Tx) error {
+		var err error
+		if len(n.path) == 0 {
+			err = tx.DeleteBucket([]byte(name))
+		} else {
+			parent := bucket(tx, n.path)
+			if parent == nil {
+				return nil
+			}
+			err = parent.DeleteBucket([]byte(name))
+		}
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return fmt.Errorf("can't drop %s: %v", name, err)
+		}
+		return nil
+	})
+}
+
+// Names returns the names of the buckets in the namespace
+func (n *boltNamespace) Names() ([]string, error) {
+	names := make([]string, 0)
+	err := n.view(func(tx *bolt.Tx) error {
+		if len(n.path) == 0 {
+			return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+				names = append(names, string(name))
+				return nil
+			})
+		}
+		b := bucket(tx, n.path)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			// values of collections are not nested buckets
+			if v == nil {
+				names = append(names, string(k))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("can't list buckets: %v", err)
+	}
+	return names, nil
+}
+
+// boltCollection stores values in a bbolt bucket
+type boltCollection struct {
+	boltDB
+	path  []string
+	codec Codec
+}
+
+// Get decodes the value of key into v
+func (c *boltCollection) Get(key string, v interface{}) (bool, error) {
+	found := false
+	err := c.view(func(tx *bolt.Tx) error {
+		b := bucket(tx, c.path)
+		if b == nil {
+			return nil
+		}
+		data := b.Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return c.codec.Unmarshal(data, v)
+	})
+	if err != nil {
+		return found, fmt.Errorf("can't get %s: %v", key, err)
+	}
+	return found, nil
+}
+
+// Put stores v as the value of key
+func (c *boltCollection) Put(key string, v interface{}) error {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("can't encode %s: %v", key, err)
+	}
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := createBucket(tx, c.path)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// Delete removes the value of key
+func (c *boltCollection) Delete(key string) error {
+	return c.update(func(tx *bolt.Tx) error {
+		b := bucket(tx, c.path)
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// Update reads, changes and writes the value of key in one transaction
+func (c *boltCollection) Update(key string, v interface{}, fn func(found bool) error) error {
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := createBucket(tx, c.path)
+		if err != nil {
+			return err
+		}
+		data := b.Get([]byte(key))
+		if data != nil {
+			if err := c.codec.Unmarshal(data, v); err != nil {
+				return fmt.Errorf("can't decode %s: %v", key, err)
+			}
+		}
+		if err := fn(data != nil); err != nil {
+			return err
+		}
+		data, err = c.codec.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("can't encode %s: %v", key, err)
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+// Iterate calls fn for each value in key order
+func (c *boltCollection) Iterate(fn func(key string, decode func(v interface{}) error) error) error {
+	return c.view(func(tx *bolt.Tx) error {
+		b := bucket(tx, c.path)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, data []byte) error {
+			// nested buckets have no value
+			if data == nil {
+				return nil
+			}
+			return fn(string(k), func(v interface{}) error {
+				return c.codec.Unmarshal(data, v)
+			})
+		})
+	})
+}
+
+// bucket returns the bucket at path or nil if it does not exist
+func bucket(tx *bolt.Tx, path []string) *bolt.Bucket {
+	b := tx.Bucket([]byte(path[0]))
+	for _, name := range path[1:] {
+		if b == nil {
+			return nil
+		}
+		b = b.Bucket([]byte(name))
+	}
+	return b
+}
+
+// createBucket returns the bucket at path, creating missing buckets
+func createBucket(tx *bolt.Tx, path []string) (*bolt.Bucket, error) {
+	b, err := tx.CreateBucketIfNotExists([]byte(path[0]))
+	if err != nil {
+		return nil, fmt.Errorf("can't create bucket %s: %v", path[0], err)
+	}
+	for _, name := range path[1:] {
+		b, err = b.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return nil, fmt.Errorf("can't create bucket %s: %v", name, err)
+		}
+	}
+	return b, nil
+}
+
+// appendPath returns a copy of path with name appended
+func appendPath(path []string, name string) []string {
+	p := make([]string, len(path), len(path)+1)
+	copy(p, path)
+	return append(p, name)
+}
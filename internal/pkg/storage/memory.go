@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// memoryNode is a namespace or a collection kept in memory
+type memoryNode struct {
+	children map[string]*memoryNode
+	values   map[string][]byte
+}
+
+func newMemoryNode() *memoryNode {
+	return &memoryNode{
+		children: make(map[string]*memoryNode),
+		values:   make(map[string][]byte),
+	}
+}
+
+// memoryStore is shared by the namespaces and collections of a tree
+type memoryStore struct {
+	mu   sync.RWMutex
+	root *memoryNode
+}
+
+// node returns the node at path, nil if it does not exist unless create
+// is true. It is called with mu held.
+func (s *memoryStore) node(path []string, create bool) *memoryNode {
+	n := s.root
+	for _, name := range path {
+		child, ok := n.children[name]
+		if !ok {
+			if !create {
+				return nil
+			}
+			child = newMemoryNode()
+			n.children[name] = child
+		}
+		n = child
+	}
+	return n
+}
+
+// memoryNamespace keeps namespaces and collections in memory, values
+// are encoded like in a database so they are never shared
+type memoryNamespace struct {
+	store *memoryStore
+	path  []string
+}
+
+// NewMemory returns the root namespace of an empty in-memory store
+func NewMemory() Namespace {
+	return &memoryNamespace{store: &memoryStore{root: newMemoryNode()}}
+}
+
+// Namespace returns the nested namespace called name
+func (n *memoryNamespace) Namespace(name string) Namespace {
+	return &memoryNamespace{store: n.store, path: appendPath(n.path, name)}
+}
+
+// Collection returns the collection called name
+func (n *memoryNamespace) Collection(name string, codec Codec) Collection {
+	return &memoryCollection{store: n.store, path: appendPath(n.path, name), codec: codec}
+}
+
+// Drop removes the node called name
+func (n *memoryNamespace) Drop(name string) error {
+	n.store.mu.Lock()
+	defer n.store.mu.Unlock()
+	if parent := n.store.node(n.path, false); parent != nil {
+		delete(parent.children, name)
+	}
+	return nil
+}
+
+// Names returns the names of the child nodes in order
+func (n *memoryNamespace) Names() ([]string, error) {
+	n.store.mu.RLock()
+	defer n.store.mu.RUnlock()
+	names := make([]string, 0)
+	if node := n.store.node(n.path, false); node != nil {
+		for name := range node.children {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// memoryCollection keeps encoded values in memory
+type memoryCollection struct {
+	store *memoryStore
+	path  []string
+	codec Codec
+}
+
+// Get decodes the value of key into v
+func (c *memoryCollection) Get(key string, v interface{}) (bool, error) {
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	n := c.store.node(c.path, false)
+	if n == nil {
+		return false, nil
+	}
+	data, ok := n.values[key]
+	if !ok {
+		return false, nil
+	}
+	if err := c.codec.Unmarshal(data, v); err != nil {
+		return true, fmt.Errorf("can't get %s: %v", key, err)
+	}
+	return true, nil
+}
+
+// Put stores v as the value of key
+func (c *memoryCollection) Put(key string, v interface{}) error {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("can't encode %s: %v", key, err)
+	}
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	c.store.node(c.path, true).values[key] = data
+	return nil
+}
+
+// Delete removes the value of key
+func (c *memoryCollection) Delete(key string) error {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	if n := c.store.node(c.path, false); n != nil {
+		delete(n.values, key)
+	}
+	return nil
+}
+
+// Update reads, changes and writes the value of key holding the lock
+func (c *memoryCollection) Update(key string, v interface{}, fn func(found bool) error) error {
+	c.store.mu.Lock()
+	defer c.store.mu.Unlock()
+	n := c.store.node(c.path, true)
+	data, found := n.values[key]
+	if found {
+		if err := c.codec.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("can't decode %s: %v", key, err)
+		}
+	}
+	if err := fn(found); err != nil {
+		return err
+	}
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("can't encode %s: %v", key, err)
+	}
+	n.values[key] = data
+	return nil
+}
+
+// Iterate calls fn for each value in key order
+func (c *memoryCollection) Iterate(fn func(key string, decode func(v interface{}) error) error) error {
+	c.store.mu.RLock()
+	defer c.store.mu.RUnlock()
+	n := c.store.node(c.path, false)
+	if n == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(n.values))
+	for k := range n.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		data := n.values[k]
+		err := fn(k, func(v interface{}) error {
+			return c.codec.Unmarshal(data, v)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Package storage defines namespaced key value collections for modules.
+// Namespaces and collections are created when they are first written to.
+package storage
+
+import (
+	"encoding/json"
+)
+
+// Namespace groups collections and nested namespaces, e.g. the data of a
+// module
+type Namespace interface {
+	// Namespace returns the nested namespace called name
+	Namespace(name string) Namespace
+	// Collection returns the collection called name storing values
+	// encoded with codec
+	Collection(name string, codec Codec) Collection
+	// Drop removes the collection or namespace called name and
+	// everything in it
+	Drop(name string) error
+	// Names returns the names of the collections and namespaces in it
+	// in order
+	Names() ([]string, error)
+}
+
+// Collection stores values by key
+type Collection interface {
+	// Get decodes the value of key into v, it returns false if there is
+	// no value
+	Get(key string, v interface{}) (bool, error)
+	// Put stores v as the value of key
+	Put(key string, v interface{}) error
+	// Delete removes the value of key
+	Delete(key string) error
+	// Update decodes the value of key into v, calls fn and stores v
+	// unless fn returns an error. found tells whether v was decoded.
+	Update(key string, v interface{}, fn func(found bool) error) error
+	// Iterate calls fn for each value in key order, decode decodes the
+	// value into its argument. fn must not write to the store.
+	Iterate(fn func(key string, decode func(v interface{}) error) error) error
+}
+
+// Codec encodes values of collections
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSON is a Codec encoding values as json
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
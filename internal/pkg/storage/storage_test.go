@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+type counter struct {
+	Name  string
+	Count int
+}
+
+// testNamespaces runs test against every implementation
+func testNamespaces(t *testing.T, test func(t *testing.T, ns Namespace)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, NewMemory())
+	})
+	t.Run("bolt", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "storage")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		db, err := bolt.Open(filepath.Join(dir, "test.db"), 0600, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		test(t, NewBolt(db))
+	})
+}
+
+func TestGetPut(t *testing.T) {
+	testNamespaces(t, func(t *testing.T, ns Namespace) {
+		c := ns.Namespace("module").Collection("counters", JSON)
+		var got counter
+		found, err := c.Get("missing", &got)
+		if err != nil || found {
+			t.Fatalf("Get of a missing key = %v, %v", found, err)
+		}
+
+		want := counter{Name: "a", Count: 1}
+		if err := c.Put("a", want); err != nil {
+			t.Fatal(err)
+		}
+		found, err = c.Get("a", &got)
+		if err != nil || !found {
+			t.Fatalf("Get = %v, %v", found, err)
+		}
+		if got != want {
+			t.Errorf("Get = %+v, want %+v", got, want)
+		}
+
+		if err := c.Delete("a"); err != nil {
+			t.Fatal(err)
+		}
+		if found, _ := c.Get("a", &got); found {
+			t.Error("deleted key was found")
+		}
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	testNamespaces(t, func(t *testing.T, ns Namespace) {
+		c := ns.Collection("counters", JSON)
+		increment := func() error {
+			var v counter
+			return c.Update("a", &v, func(found bool) error {
+				if !found {
+					v.Name = "a"
+				}
+				v.Count++
+				return nil
+			})
+		}
+		for i := 0; i < 3; i++ {
+			if err := increment(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		errFailed := errors.New("failed")
+		var v counter
+		err := c.Update("a", &v, func(found bool) error {
+			v.Count = 100
+			return errFailed
+		})
+		if err != errFailed {
+			t.Errorf("Update returned %v, want %v", err, errFailed)
+		}
+
+		var got counter
+		c.Get("a", &got)
+		if want := (counter{Name: "a", Count: 3}); got != want {
+			t.Errorf("Get = %+v, want %+v", got, want)
+		}
+	})
+}
+
+func TestIterate(t *testing.T) {
+	testNamespaces(t, func(t *testing.T, ns Namespace) {
+		c := ns.Collection("counters", JSON)
+		if err := c.Iterate(func(string, func(interface{}) error) error {
+			t.Error("missing collection is not empty")
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, k := range []string{"c", "a", "b"} {
+			c.Put(k, counter{Name: k})
+		}
+		// values of nested namespaces are not part of the collection
+		ns.Namespace("counters").Collection("nested", JSON).Put("x", counter{})
+
+		var keys, names []string
+		err := c.Iterate(func(key string, decode func(interface{}) error) error {
+			var v counter
+			if err := decode(&v); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			names = append(names, v.Name)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"a", "b", "c"}
+		if !reflect.DeepEqual(keys, want) || !reflect.DeepEqual(names, want) {
+			t.Errorf("Iterate = %v %v, want %v", keys, names, want)
+		}
+	})
+}
+
+func TestDrop(t *testing.T) {
+	testNamespaces(t, func(t *testing.T, ns Namespace) {
+		module := ns.Namespace("module")
+		module.Collection("#a", JSON).Put("nick", counter{Count: 1})
+		module.Collection("#b", JSON).Put("nick", counter{Count: 2})
+
+		if err := module.Drop("#a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := module.Drop("#missing"); err != nil {
+			t.Errorf("Drop of a missing collection returned %v", err)
+		}
+		var v counter
+		if found, _ := module.Collection("#a", JSON).Get("nick", &v); found {
+			t.Error("dropped collection still has values")
+		}
+		if found, _ := module.Collection("#b", JSON).Get("nick", &v); !found || v.Count != 2 {
+			t.Error("other collection was dropped")
+		}
+
+		if err := ns.Drop("module"); err != nil {
+			t.Fatal(err)
+		}
+		if found, _ := module.Collection("#b", JSON).Get("nick", &v); found {
+			t.Error("dropped namespace still has values")
+		}
+	})
+}
+
+func TestNames(t *testing.T) {
+	testNamespaces(t, func(t *testing.T, ns Namespace) {
+		module := ns.Namespace("module")
+		if names, err := module.Names(); err != nil || len(names) != 0 {
+			t.Fatalf("Names of a missing namespace = %v, %v", names, err)
+		}
+		module.Collection("#b", JSON).Put("nick", counter{Count: 1})
+		module.Collection("#a", JSON).Put("nick", counter{Count: 2})
+		module.Namespace("nested").Collection("c", JSON).Put("nick", counter{Count: 3})
+		ns.Collection("top", JSON).Put("nick", counter{Count: 4})
+
+		names, err := module.Names()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"#a", "#b", "nested"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("Names = %v, want %v", names, want)
+		}
+		names, err = ns.Names()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"module", "top"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("Names of the root = %v, want %v", names, want)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SplitMessage splits message into lines of at most maxBytes bytes.
+// Lines are split at spaces when possible and never inside a UTF-8
+// encoded rune. Newlines in message always start a new line.
+func SplitMessage(message string, maxBytes int) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(message, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		lines = append(lines, splitLine(line, maxBytes)...)
+	}
+	return lines
+}
+
+func splitLine(line string, maxBytes int) []string {
+	if maxBytes < utf8.UTFMax {
+		maxBytes = utf8.UTFMax
+	}
+	lines := make([]string, 0)
+	for len(line) > maxBytes {
+		cut := strings.LastIndexByte(line[:maxBytes+1], ' ')
+		if cut <= 0 {
+			// no space to split at, cut at the last full rune
+			cut = maxBytes
+			for cut > 0 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				_, size := utf8.DecodeRuneInString(line)
+				cut = size
+			}
+		}
+		lines = append(lines, strings.TrimRight(line[:cut], " "))
+		line = strings.TrimLeft(line[cut:], " ")
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// Truncate shortens s to at most maxBytes bytes without splitting a rune
+func Truncate(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut]
+}
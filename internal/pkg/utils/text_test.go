@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  string
+		maxBytes int
+		want     []string
+	}{
+		{"short", "hello world", 20, []string{"hello world"}},
+		{"at space", "hello world again", 11, []string{"hello world", "again"}},
+		{"newlines", "first\r\n\nsecond\n", 20, []string{"first", "second"}},
+		{"no space", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		// ä is two bytes, so five bytes fit only two of them
+		{"two byte runes", "ääääää", 5, []string{"ää", "ää", "ää"}},
+		{"three byte runes", "€€€€", 7, []string{"€€", "€€"}},
+		{"mixed", "aä€😀b", 4, []string{"aä", "€", "😀", "b"}},
+		{"runes at space", "ää ää", 5, []string{"ää", "ää"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitMessage(tt.message, tt.maxBytes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitMessage(%q, %d) = %q, want %q", tt.message, tt.maxBytes, got, tt.want)
+			}
+			for _, line := range got {
+				if !utf8.ValidString(line) {
+					t.Errorf("line %q is not valid UTF-8", line)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitMessageLength(t *testing.T) {
+	message := strings.Repeat("öljyä ja €uroja 😀 ", 50)
+	for maxBytes := 4; maxBytes < 40; maxBytes++ {
+		lines := SplitMessage(message, maxBytes)
+		for _, line := range lines {
+			if len(line) > maxBytes || !utf8.ValidString(line) {
+				t.Fatalf("SplitMessage(..., %d) returned %q", maxBytes, line)
+			}
+		}
+		// only the spaces lines were split at are dropped
+		if joined, want := strings.Join(lines, ""), strings.Replace(message, " ", "", -1); strings.Replace(joined, " ", "", -1) != want {
+			t.Fatalf("SplitMessage(..., %d) lost text", maxBytes)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s        string
+		maxBytes int
+		want     string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"ääkkönen", 3, "ä"},
+		{"ääkkönen", 4, "ää"},
+		{"€", 2, ""},
+	}
+	for _, tt := range tests {
+		if got := Truncate(tt.s, tt.maxBytes); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.s, tt.maxBytes, got, tt.want)
+		}
+	}
+}